@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// dataExport is the archive returned by "download my data".
+type dataExport struct {
+	ExportedAt  time.Time     `json:"exported_at"`
+	User        User          `json:"user"`
+	Memberships []Membership  `json:"workspaces"`
+	Sessions    []UserSession `json:"sessions"`
+	AuthEvents  []AuthEvent   `json:"auth_history"`
+}
+
+func (a *Auth) handleAccountPassword(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	user := CurrentUser(c)
+
+	if ok, _, _ := a.verifyPassword(c.UserContext(), user.Password, c.FormValue("current_password")); !ok {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("account.wrong_password"), ""))
+	}
+
+	if reasons := a.validateNewPassword(l, c.FormValue("password"), c.FormValue("confirm_password"), user.Email); len(reasons) > 0 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, reasonsHTML(reasons), ""))
+	}
+
+	event := newHookEvent(c, ActionPasswordChange, user)
+	if err := a.before(c, event); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, html.EscapeString(err.Error()), ""))
+	}
+
+	hash, err := a.hashPassword(c.UserContext(), c.FormValue("password"))
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("account.password_change_failed"), ""))
+	}
+	a.dbFor(c).Model(user).Updates(map[string]interface{}{"password": hash, "password_change_required": false})
+	a.recordAuthEvent(c, user.ID, eventPasswordChange)
+
+	sess, _ := a.loadSession(c)
+	a.revokeUserSessions(user.ID, sess.ID())
+	a.after(c.UserContext(), event)
+
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleAccountPhone(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	user := CurrentUser(c)
+
+	if strings.TrimSpace(c.FormValue("phone")) == "" {
+		a.dbFor(c).Model(user).Updates(map[string]interface{}{"phone": "", "phone_e164": gorm.Expr("NULL")})
+		return c.Redirect(a.path("/dashboard"))
+	}
+
+	display, e164, err := a.normalizePhone(c.FormValue("phone"))
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, html.EscapeString(l.Err(err)), ""))
+	}
+
+	var other int64
+	a.dbFor(c).Model(&User{}).Where("phone_e164 = ? AND id <> ?", e164, user.ID).Count(&other)
+	if other > 0 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("account.phone_taken"), ""))
+	}
+
+	if err := a.dbFor(c).Model(user).Updates(map[string]interface{}{"phone": display, "phone_e164": e164}).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("account.phone_save_failed"), ""))
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleAccountExport(c *fiber.Ctx) error {
+	user := CurrentUser(c)
+
+	export := dataExport{ExportedAt: time.Now().UTC(), User: *user, Memberships: a.userMemberships(user.ID)}
+	a.dbFor(c).Where("user_id = ?", user.ID).Order("created_at").Find(&export.Sessions)
+	a.dbFor(c).Where("user_id = ?", user.ID).Order("created_at").Find(&export.AuthEvents)
+
+	a.recordAuthEvent(c, user.ID, eventDataExport)
+
+	c.Attachment(fmt.Sprintf("glassauth-export-%d-%s.json", user.ID, export.ExportedAt.Format("20060102")))
+	return c.JSON(export)
+}
+
+func (a *Auth) handleAccountDelete(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	user := CurrentUser(c)
+
+	if ok, _, _ := a.verifyPassword(c.UserContext(), user.Password, c.FormValue("password")); !ok {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("account.delete_wrong_password"), ""))
+	}
+
+	if err := a.before(c, newHookEvent(c, ActionDelete, user)); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, html.EscapeString(err.Error()), ""))
+	}
+
+	sess, _ := a.loadSession(c)
+
+	if a.cfg.AccountDeletionGrace <= 0 {
+		if err := a.deleteUser(c.UserContext(), user.ID, c.IP()); err != nil {
+			c.Type("html")
+			return c.SendString(a.renderDashboard(c, l.H("account.delete_failed"), ""))
+		}
+		sess.Destroy()
+		return c.Redirect(a.path("/login"))
+	}
+
+	deleteAfter := time.Now().Add(a.cfg.AccountDeletionGrace)
+	if err := a.dbFor(c).Model(user).Update("delete_after", deleteAfter).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("account.delete_failed"), ""))
+	}
+	a.recordAuthEvent(c, user.ID, eventDeletionRequested)
+	a.revokeUserSessions(user.ID, sess.ID())
+
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleAccountDeleteCancel(c *fiber.Ctx) error {
+	user := CurrentUser(c)
+	if user.DeleteAfter != nil {
+		a.dbFor(c).Model(user).Update("delete_after", nil)
+		a.recordAuthEvent(c, user.ID, eventDeletionCancelled)
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// deleteUser hard-deletes a user together with every record that
+// references them, strips their address from webhook payloads, revokes
+// their live sessions and then runs the After hooks. ip is the address
+// that asked for the deletion, if any.
+func (a *Auth) deleteUser(ctx context.Context, userID uint, ip string) error {
+	var user User
+	if err := a.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	a.revokeUserSessions(userID, "")
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&UserSession{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&AuthEvent{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&MagicLinkToken{}).Error; err != nil {
+			return err
+		}
+		if err := deleteUserMemberships(tx, userID); err != nil {
+			return err
+		}
+		// Invitations hold the invitee's address and point at the inviter,
+		// so those sent by or to the user go too.
+		invited := ""
+		if user.EmailNormalized != nil {
+			invited = *user.EmailNormalized
+		}
+		if err := tx.Where("created_by_id = ? OR (email_normalized <> '' AND email_normalized = ?)", userID, invited).Delete(&Invitation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("invited_by_id = ? OR email_normalized = ?", userID, invited).Delete(&OrgInvitation{}).Error; err != nil {
+			return err
+		}
+		if err := scrubWebhookDeliveries(tx, userID); err != nil {
+			return err
+		}
+		return tx.Delete(&User{}, userID).Error
+	})
+	if err != nil {
+		return err
+	}
+	a.after(ctx, HookEvent{Action: ActionDelete, User: &user, Email: user.Email, IP: ip})
+	return nil
+}
+
+// purgeDeletedAccounts removes every account whose grace period ended
+// before now.
+func (a *Auth) purgeDeletedAccounts(now time.Time) {
+	var ids []uint
+	a.db.Model(&User{}).Where("delete_after IS NOT NULL AND delete_after <= ?", now).Pluck("id", &ids)
+	for _, id := range ids {
+		if err := a.deleteUser(context.Background(), id, ""); err != nil {
+			a.logger.Warn("Failed to purge user", "user_id", id, "error", err)
+			continue
+		}
+		a.logger.Info("Purged user after deletion grace period", "user_id", id)
+	}
+}
+
+// StartPurger deletes accounts whose deletion grace period has ended, now
+// and then every interval, in a background goroutine. It also drops
+// expired pending registrations and refreshes the mix of password hash
+// formats unknown-account logins imitate.
+func (a *Auth) StartPurger(interval time.Duration) {
+	go func() {
+		for {
+			a.purgeDeletedAccounts(time.Now())
+			a.purgeExpiredRegistrations(time.Now())
+			a.refreshHasherShares(context.Background())
+			time.Sleep(interval)
+		}
+	}()
+}
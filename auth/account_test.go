@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rowsFor counts the rows of model that belong to userID.
+func (e *testEnv) rowsFor(model any, userID uint) int64 {
+	var n int64
+	e.auth.db.Model(model).Where("user_id = ?", userID).Count(&n)
+	return n
+}
+
+func TestDeletingAnAccountRemovesItsRecords(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) { cfg.AccountDeletionGrace = 0 })
+	user := e.registerUser(t, e.client(t), "user@example.com", testPassword)
+	c := e.client(t)
+	c.login("user@example.com", testPassword)
+
+	if _, page := c.post("/account/delete", url.Values{"password": {"wrong"}}); !strings.Contains(page, englishLocalizer().H("account.delete_wrong_password")) ||
+		e.rowsFor(&Membership{}, user.ID) == 0 {
+		t.Fatal("a wrong password deleted the account")
+	}
+
+	if resp, _ := c.post("/account/delete", url.Values{"password": {testPassword}}); resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("deleting: status %d", resp.StatusCode)
+	}
+	var users int64
+	e.auth.db.Model(&User{}).Where("id = ?", user.ID).Count(&users)
+	if users != 0 {
+		t.Error("the user still exists")
+	}
+	for _, model := range []any{&Membership{}, &UserSession{}, &AuthEvent{}} {
+		if n := e.rowsFor(model, user.ID); n != 0 {
+			t.Errorf("%T: %d rows left", model, n)
+		}
+	}
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusFound {
+		t.Errorf("dashboard after deleting: status %d, want a redirect", resp.StatusCode)
+	}
+	if e.client(t).login("user@example.com", testPassword) {
+		t.Error("the deleted account still signs in")
+	}
+}
+
+func TestDeletingAnAccountForgetsItsInvitationsAndWebhookPayloads(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) { cfg.AccountDeletionGrace = 0 })
+	e.auth.db.Create(&WebhookEndpoint{URL: "http://127.0.0.1:1/hook", Secret: "secret"})
+	other := e.createUser(t, "other@example.com", testPassword, true)
+	inviter := e.client(t)
+	inviter.login("other@example.com", testPassword)
+
+	c := e.client(t)
+	user := e.registerUser(t, c, "user@example.com", testPassword)
+	createInvitation(t, inviter, url.Values{"email": {"user@example.com"}})
+	e.inviteToWorkspace(t, inviter, "user@example.com")
+	createInvitation(t, c, url.Values{"email": {"friend@example.com"}})
+	e.inviteToWorkspace(t, c, "colleague@example.com")
+
+	// A delivery queued before deliveries recorded their user.
+	legacy, _ := json.Marshal(webhookPayload{ID: "legacy", Type: eventLogin, Data: webhookData{UserID: user.ID, Email: user.Email, IP: "203.0.113.7"}})
+	e.auth.db.Create(&WebhookDelivery{EndpointID: 1, Event: eventLogin, Payload: string(legacy), Status: deliveryDead, NextAttemptAt: time.Now()})
+
+	if resp, _ := c.post("/account/delete", url.Values{"password": {testPassword}}); resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("deleting: status %d", resp.StatusCode)
+	}
+
+	var invitations, orgInvitations int64
+	e.auth.db.Model(&Invitation{}).Where("created_by_id = ? OR email = ?", user.ID, user.Email).Count(&invitations)
+	e.auth.db.Model(&OrgInvitation{}).Where("invited_by_id = ? OR email = ?", user.ID, user.Email).Count(&orgInvitations)
+	if invitations != 0 || orgInvitations != 0 {
+		t.Errorf("%d invitations and %d workspace invitations left", invitations, orgInvitations)
+	}
+
+	var deliveries []WebhookDelivery
+	e.auth.db.Find(&deliveries)
+	scrubbed, kept := 0, 0
+	for _, d := range deliveries {
+		var payload webhookPayload
+		if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+			t.Fatal(err)
+		}
+		switch payload.Data.UserID {
+		case user.ID:
+			scrubbed++
+			if strings.Contains(d.Payload, user.Email) || payload.Data.IP != "" {
+				t.Errorf("delivery %d still holds %s", d.ID, d.Payload)
+			}
+		case other.ID:
+			kept++
+			if payload.Data.Email != other.Email {
+				t.Errorf("delivery %d for another user was changed: %s", d.ID, d.Payload)
+			}
+		}
+	}
+	if scrubbed < 3 || kept == 0 {
+		t.Errorf("%d deliveries for the deleted user and %d for the other one, want both kept", scrubbed, kept)
+	}
+}
+
+func TestAccountDeletionGracePeriod(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	c := e.client(t)
+	c.login("user@example.com", testPassword)
+
+	c.post("/account/delete", url.Values{"password": {testPassword}})
+	e.auth.db.First(user, user.ID)
+	if user.DeleteAfter == nil {
+		t.Fatal("no deletion scheduled")
+	}
+	c.post("/account/delete/cancel", nil)
+	var cancelled User
+	e.auth.db.First(&cancelled, user.ID)
+	if cancelled.DeleteAfter != nil {
+		t.Fatal("cancelling kept the deletion scheduled")
+	}
+
+	c.post("/account/delete", url.Values{"password": {testPassword}})
+	e.auth.purgeDeletedAccounts(time.Now())
+	if err := e.auth.db.First(&User{}, user.ID).Error; err != nil {
+		t.Fatal("purged before the grace period ended")
+	}
+	e.auth.purgeDeletedAccounts(time.Now().Add(e.auth.cfg.AccountDeletionGrace + time.Minute))
+	if err := e.auth.db.First(&User{}, user.ID).Error; err == nil {
+		t.Error("not purged after the grace period")
+	}
+}
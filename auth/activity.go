@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// Auth event types recorded in a user's history.
+const (
+	eventRegister          = "register"
+	eventLogin             = "login"
+	eventLoginFailed       = "login_failed"
+	eventMagicLinkLogin    = "magic_link_login"
+	eventLogout            = "logout"
+	eventPasswordChange    = "password_change"
+	eventDataExport        = "data_export"
+	eventDeletionRequested = "deletion_requested"
+	eventDeletionCancelled = "deletion_cancelled"
+)
+
+type AuthEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	Type      string    `gorm:"size:32;not null" json:"type"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	UserAgent string    `gorm:"size:255" json:"user_agent"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Reasons a session expired, passed to the login page.
+const (
+	expiredIdle     = "idle"
+	expiredAbsolute = "absolute"
+)
+
+// UserSession mirrors a session held in the session store so it can be
+// listed, exported and revoked per user. The session ID itself is never
+// exported since it is a bearer credential.
+type UserSession struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	UserID     uint      `gorm:"index;not null" json:"-"`
+	SessionID  string    `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+func (a *Auth) recordAuthEvent(c *fiber.Ctx, userID uint, eventType string) {
+	a.saveAuthEvent(c.UserContext(), a.requestLogger(c), newAuthEvent(c, userID, eventType))
+}
+
+// Size of the background auth event queue and the number of workers
+// draining it.
+const (
+	authEventQueueSize = 256
+	authEventWorkers   = 2
+)
+
+// queuedAuthEvent is an auth event waiting to be saved in the background.
+type queuedAuthEvent struct {
+	ctx    context.Context
+	logger *slog.Logger
+	event  AuthEvent
+}
+
+// recordAuthEventInBackground is recordAuthEvent off the request path. A
+// failed login for a real account costs an insert and a webhook lookup that
+// one for an unknown account doesn't, and the difference would otherwise
+// show up in response times. Events are handed to a fixed set of workers;
+// when their queue is full the event is dropped and counted, so a burst of
+// failed logins can't pile up work.
+func (a *Auth) recordAuthEventInBackground(c *fiber.Ctx, userID uint, eventType string) {
+	a.eventWorkers.Do(func() {
+		for range authEventWorkers {
+			go func() {
+				for q := range a.eventQueue {
+					a.saveAuthEvent(q.ctx, q.logger, q.event)
+				}
+			}()
+		}
+	})
+	q := queuedAuthEvent{
+		ctx:    context.WithoutCancel(c.UserContext()),
+		logger: a.requestLogger(c),
+		event:  newAuthEvent(c, userID, eventType),
+	}
+	select {
+	case a.eventQueue <- q:
+	default:
+		a.metrics.droppedAuthEventsTotal.WithLabelValues(eventType).Inc()
+	}
+}
+
+// newAuthEvent describes eventType for the client of c. The strings are
+// copied since Fiber reuses request buffers once the handler returns.
+func newAuthEvent(c *fiber.Ctx, userID uint, eventType string) AuthEvent {
+	return AuthEvent{
+		UserID:    userID,
+		Type:      eventType,
+		IP:        utils.CopyString(c.IP()),
+		UserAgent: utils.CopyString(truncate(c.Get(fiber.HeaderUserAgent), 255)),
+	}
+}
+
+func (a *Auth) saveAuthEvent(ctx context.Context, logger *slog.Logger, event AuthEvent) {
+	if err := a.db.WithContext(ctx).Create(&event).Error; err != nil {
+		logger.Warn("Failed to record auth event", "event", event.Type, "user_id", event.UserID, "error", err)
+	}
+	a.queueWebhooks(ctx, logger, event.Type, event.UserID, event.IP)
+}
+
+// signIn binds user to a new session and tracks it. The session gets a
+// fresh ID, so one planted in the browser beforehand never becomes
+// authenticated.
+func (a *Auth) signIn(c *fiber.Ctx, user *User) error {
+	sess, err := a.loadSession(c)
+	if err != nil {
+		return err
+	}
+	if err := sess.Reset(); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	sess.Set("userID", user.ID)
+	sess.Set("userEmail", user.Email)
+	sess.Set("signedInAt", now)
+	sess.Set("lastSeenAt", now)
+
+	// Save releases the session, so capture its ID first.
+	sessionID := sess.ID()
+	if err := a.saveSession(c, sess); err != nil {
+		return err
+	}
+
+	c.Locals(userKey, user)
+	if user.Locale != "" {
+		a.setLanguageCookie(c, user.Locale)
+	}
+
+	a.dbFor(c).Where("session_id = ?", sessionID).Delete(&UserSession{})
+	a.dbFor(c).Create(&UserSession{
+		UserID:     user.ID,
+		SessionID:  sessionID,
+		IP:         c.IP(),
+		UserAgent:  truncate(c.Get(fiber.HeaderUserAgent), 255),
+		LastSeenAt: time.Now(),
+	})
+	return nil
+}
+
+// sessionExpired returns why sess is no longer valid, expiredIdle or
+// expiredAbsolute, or "" while it is.
+func (a *Auth) sessionExpired(sess *session.Session) string {
+	now := time.Now()
+	if signedInAt, ok := sess.Get("signedInAt").(int64); ok && now.Sub(time.Unix(signedInAt, 0)) > a.absoluteTimeout {
+		return expiredAbsolute
+	}
+	if lastSeenAt, ok := sess.Get("lastSeenAt").(int64); ok && now.Sub(time.Unix(lastSeenAt, 0)) > a.idleTimeout {
+		return expiredIdle
+	}
+	return ""
+}
+
+// touchSession records activity on sess, which restarts its idle timeout,
+// and on its tracked UserSession. To spare the store and the database a
+// write per request, both are only written once the last recorded activity
+// is a tenth of the idle timeout, at most a minute, old.
+func (a *Auth) touchSession(c *fiber.Ctx, sess *session.Session) {
+	now := time.Now()
+	lastSeenAt, _ := sess.Get("lastSeenAt").(int64)
+	if now.Sub(time.Unix(lastSeenAt, 0)) < min(a.idleTimeout/10, time.Minute) {
+		return
+	}
+	if _, ok := sess.Get("signedInAt").(int64); !ok {
+		sess.Set("signedInAt", now.Unix())
+	}
+	sess.Set("lastSeenAt", now.Unix())
+	sessionID := sess.ID()
+	if err := a.saveSession(c, sess); err != nil {
+		a.requestLogger(c).Warn("Failed to save session activity", "error", err)
+	}
+	a.dbFor(c).Model(&UserSession{}).Where("session_id = ?", sessionID).Update("last_seen_at", now)
+}
+
+// revokeUserSessions destroys every tracked session of userID except keepID.
+func (a *Auth) revokeUserSessions(userID uint, keepID string) {
+	var sessions []UserSession
+	a.db.Where("user_id = ? AND session_id <> ?", userID, keepID).Find(&sessions)
+	for _, s := range sessions {
+		if err := a.store.Delete(s.SessionID); err != nil {
+			a.logger.Warn("Failed to revoke session", "user_session_id", s.ID, "error", err)
+		}
+		a.db.Delete(&s)
+	}
+}
+
+// truncate cuts s to at most n bytes, backing up to the start of a rune so
+// that a multi-byte character is never split.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSessionActivityIsThrottledAndCountedWithinIdleTimeout(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	c := e.client(t)
+	c.login("user@example.com", testPassword)
+
+	active := func() int64 {
+		t.Helper()
+		n, err := e.auth.ActiveSessions(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	lastSeen := func() time.Time {
+		var s UserSession
+		e.auth.db.Where("user_id = ?", user.ID).First(&s)
+		return s.LastSeenAt
+	}
+
+	// Idle for longer than the idle timeout but not the store's expiration.
+	stale := time.Now().Add(-2 * e.auth.idleTimeout).Truncate(time.Second)
+	e.auth.db.Model(&UserSession{}).Where("user_id = ?", user.ID).Update("last_seen_at", stale)
+	if n := active(); n != 0 {
+		t.Errorf("active sessions = %d, want 0 once idle past the timeout", n)
+	}
+
+	// Requests right after signing in don't write activity.
+	c.get("/dashboard")
+	if !lastSeen().Equal(stale) {
+		t.Error("last_seen_at was written on every request")
+	}
+
+	e.auth.idleTimeout = 3 * time.Second
+	time.Sleep(1100 * time.Millisecond)
+	c.get("/dashboard")
+	if !lastSeen().After(stale) {
+		t.Error("last_seen_at wasn't written once the throttle passed")
+	}
+	if n := active(); n != 1 {
+		t.Errorf("active sessions = %d, want 1", n)
+	}
+}
+
+func TestTruncateKeepsRunesWhole(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"Mozilla/5.0", 20, "Mozilla/5.0"},
+		{"Mozilla/5.0", 7, "Mozilla"},
+		{"naïve", 3, "na"},
+		{"naïve", 4, "naï"},
+		{"日本語", 5, "日"},
+		{"日本語", 2, ""},
+		{"😀x", 3, ""},
+	} {
+		got := truncate(tc.s, tc.n)
+		if got != tc.want || !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+//go:embed assets
+var assetFiles embed.FS
+
+// asset is an embedded file served under a name that includes a hash of
+// its content, so it can be cached forever.
+type asset struct {
+	name        string
+	contentType string
+	body        []byte
+}
+
+// assets maps an asset's plain name, e.g. "app.css", to the asset.
+var assets = loadAssets()
+
+// assetsByHashedName maps the served name, e.g. "app.1a2b3c4d5e.css", to
+// the asset.
+var assetsByHashedName = func() map[string]*asset {
+	byName := map[string]*asset{}
+	for _, a := range assets {
+		byName[a.name] = a
+	}
+	return byName
+}()
+
+func loadAssets() map[string]*asset {
+	loaded := map[string]*asset{}
+	err := fs.WalkDir(assetFiles, "assets", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		body, err := assetFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(body)
+		name := path.Base(p)
+		ext := path.Ext(name)
+		loaded[name] = &asset{
+			name:        strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:5]) + ext,
+			contentType: mime.TypeByExtension(ext),
+			body:        body,
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// asset returns the URL of the embedded file name.
+func (a *Auth) asset(name string) string {
+	return a.path("/assets/" + assets[name].name)
+}
+
+func handleAsset(c *fiber.Ctx) error {
+	asset, ok := assetsByHashedName[c.Params("file")]
+	if !ok {
+		return fiber.ErrNotFound
+	}
+	c.Set(fiber.HeaderContentType, asset.contentType)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	return c.Send(asset.body)
+}
@@ -0,0 +1,19 @@
+// Form behaviors wired up here rather than in inline event handlers, which
+// the Content-Security-Policy blocks.
+document.addEventListener('DOMContentLoaded', () => {
+    // <form data-confirm="Question?"> asks before submitting.
+    document.querySelectorAll('form[data-confirm]').forEach((form) => {
+        form.addEventListener('submit', (e) => {
+            if (!confirm(form.dataset.confirm)) e.preventDefault();
+        });
+    });
+
+    // <select data-autosubmit> submits its form when changed. With
+    // data-autosubmit="action" the selected value is the form's action.
+    document.querySelectorAll('select[data-autosubmit]').forEach((select) => {
+        select.addEventListener('change', () => {
+            if (select.dataset.autosubmit === 'action') select.form.action = select.value;
+            select.form.submit();
+        });
+    });
+});
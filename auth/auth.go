@@ -0,0 +1,374 @@
+// Package auth is a complete email/password authentication system for Fiber
+// apps: registration, login, magic links, invitations, workspaces and
+// account management, with its own pages.
+//
+//	a, err := auth.New(auth.Options{DB: db, Store: store})
+//	if err != nil { ... }
+//	if err := a.Migrate(ctx); err != nil { ... }
+//	a.Mount(app)
+//	app.Get("/reports", a.RequireAuth, func(c *fiber.Ctx) error {
+//		return c.SendString("Hello " + auth.CurrentUser(c).Email)
+//	})
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// Options configures an Auth. DB and Store are required.
+type Options struct {
+	// DB stores users, sessions and everything else the module owns.
+	DB *gorm.DB
+	// Store holds login sessions.
+	Store *session.Store
+	// Mailer delivers sign-in links, invitations and notices. Defaults to
+	// the mailer selected by MAIL_DRIVER.
+	Mailer Mailer
+	// BasePath prefixes every route and link, e.g. "/auth". Defaults to
+	// the root.
+	BasePath string
+	// BaseURL is the public origin used for links in emails. Defaults to
+	// APP_BASE_URL, or http://localhost:$PORT.
+	BaseURL string
+	// Logger receives the module's logs. Defaults to slog.Default().
+	Logger *slog.Logger
+	// Hooks run, in order, around registration, login, logout, password
+	// changes and account deletion.
+	Hooks []Hook
+	// Theme sets the product name, logo, fonts and colors of the pages.
+	// Defaults to the theme selected by THEME and related variables.
+	Theme *Theme
+	// SessionIdleTimeout signs out sessions unused for this long. Defaults
+	// to SESSION_IDLE_TIMEOUT, or one hour.
+	SessionIdleTimeout time.Duration
+	// SessionAbsoluteTimeout signs out sessions this long after sign-in,
+	// however active they are. Defaults to the store's Expiration.
+	SessionAbsoluteTimeout time.Duration
+	// Config tunes registration, passwords, emailed links and webhooks.
+	// Defaults to ConfigFromEnv.
+	Config *Config
+	// Registerer receives the module's Prometheus metrics. Defaults to
+	// prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+// Auth serves the authentication pages and guards routes of a Fiber app.
+type Auth struct {
+	db       *gorm.DB
+	store    *session.Store
+	mailer   Mailer
+	basePath string
+	baseURL  string
+	logger   *slog.Logger
+	hooks    []Hook
+	theme    Theme
+	cfg      Config
+	metrics  *metrics
+
+	// hashers holds every supported password hasher; the first one is
+	// used for new hashes and hashes in any other format are upgraded to
+	// it. dummyHashes holds one hash from each, verified against when no
+	// account matches so unknown emails take as long to reject as wrong
+	// passwords; see dummyHashFor.
+	hashers         []PasswordHasher
+	dummyHashes     []string
+	dummyKey        []byte
+	hasherShares    atomic.Pointer[[]float64]
+	breachChecker   BreachChecker
+	plusFoldDomains map[string]bool
+	webhookClient   *http.Client
+
+	// eventQueue feeds the workers that save auth events recorded off the
+	// request path; see recordAuthEventInBackground.
+	eventQueue   chan queuedAuthEvent
+	eventWorkers sync.Once
+
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+
+	// demo shows the demo credentials on the login page once
+	// SeedDemoUser has created them.
+	demo bool
+}
+
+// Keys for the values the module stores in fiber.Ctx locals.
+type localsKey int
+
+const (
+	userKey localsKey = iota
+	membershipKey
+	localizerKey
+	nonceKey
+	framingDeniedKey
+)
+
+// models lists every table the module migrates.
+var models = []interface{}{
+	&User{}, &AuthEvent{}, &UserSession{}, &MagicLinkToken{}, &Invitation{}, &PendingRegistration{},
+	&Organization{}, &Membership{}, &OrgInvitation{}, &WebhookEndpoint{}, &WebhookDelivery{},
+}
+
+// New returns an Auth for opts. Call Migrate before serving requests.
+func New(opts Options) (*Auth, error) {
+	if opts.DB == nil {
+		return nil, errors.New("auth: Options.DB is required")
+	}
+	if opts.Store == nil {
+		return nil, errors.New("auth: Options.Store is required")
+	}
+
+	a := &Auth{
+		db:       opts.DB,
+		store:    opts.Store,
+		mailer:   opts.Mailer,
+		basePath: strings.TrimSuffix(opts.BasePath, "/"),
+		baseURL:  strings.TrimSuffix(opts.BaseURL, "/"),
+		logger:   opts.Logger,
+		hooks:    opts.Hooks,
+
+		idleTimeout:     opts.SessionIdleTimeout,
+		absoluteTimeout: opts.SessionAbsoluteTimeout,
+	}
+	if a.logger == nil {
+		a.logger = slog.Default()
+	}
+	if a.mailer == nil {
+		m, err := MailerFromEnv(a.logger)
+		if err != nil {
+			return nil, err
+		}
+		a.mailer = m
+	}
+	if opts.Theme != nil {
+		a.theme = *opts.Theme
+		if err := a.theme.validate(); err != nil {
+			return nil, err
+		}
+	} else {
+		t, err := ThemeFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		a.theme = t
+	}
+	if a.baseURL == "" {
+		a.baseURL = strings.TrimSuffix(env.String("APP_BASE_URL", "http://localhost:"+env.String("PORT", "3000")), "/")
+	}
+	if a.idleTimeout <= 0 {
+		a.idleTimeout = env.Duration("SESSION_IDLE_TIMEOUT", time.Hour)
+	}
+	if a.absoluteTimeout <= 0 {
+		a.absoluteTimeout = a.store.Expiration
+	}
+
+	if opts.Config != nil {
+		a.cfg = *opts.Config
+		if err := a.cfg.validate(); err != nil {
+			return nil, err
+		}
+	} else {
+		cfg, err := ConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		a.cfg = cfg
+	}
+	reg := opts.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	var err error
+	if a.metrics, err = newMetrics(reg); err != nil {
+		return nil, err
+	}
+	a.hashers = a.cfg.hashers()
+	for _, h := range a.hashers {
+		hash, err := h.Hash("not-a-real-password")
+		if err != nil {
+			return nil, err
+		}
+		a.dummyHashes = append(a.dummyHashes, hash)
+	}
+	a.dummyKey = []byte(randomToken(32))
+	if a.breachChecker, err = loadBreachChecker(&a.cfg, a.logger); err != nil {
+		return nil, err
+	}
+	a.plusFoldDomains = plusFoldDomainSet(a.cfg.EmailPlusFoldDomains)
+	a.webhookClient = &http.Client{Timeout: a.cfg.WebhookTimeout}
+	a.eventQueue = make(chan queuedAuthEvent, authEventQueueSize)
+	return a, nil
+}
+
+// Migrate creates or updates the module's tables, backfills data added by
+// newer versions, gives every user a workspace and applies
+// Config.AdminEmails.
+func (a *Auth) Migrate(ctx context.Context) error {
+	db := a.db.WithContext(ctx)
+	if err := db.AutoMigrate(models...); err != nil {
+		return err
+	}
+	a.backfillNormalizedEmails()
+	a.backfillPhones()
+	a.ensurePersonalWorkspaces()
+	a.promoteAdmins()
+	a.refreshHasherShares(ctx)
+	return nil
+}
+
+// CheckSchema reports an error if any of the module's tables is missing.
+func (a *Auth) CheckSchema(ctx context.Context) error {
+	migrator := a.db.WithContext(ctx).Migrator()
+	for _, m := range models {
+		if !migrator.HasTable(m) {
+			return fmt.Errorf("missing table for %T", m)
+		}
+	}
+	return nil
+}
+
+// ActiveSessions counts tracked sessions used within the idle timeout.
+func (a *Auth) ActiveSessions(ctx context.Context) (int64, error) {
+	var count int64
+	err := a.db.WithContext(ctx).Model(&UserSession{}).
+		Where("last_seen_at > ?", time.Now().Add(-a.idleTimeout)).
+		Count(&count).Error
+	return count, err
+}
+
+// Mount registers the module's pages and form handlers on app under
+// BasePath.
+func (a *Auth) Mount(app fiber.Router) {
+	r := app.Group(a.basePath)
+	owner := orgRoleRequired(orgRoleOwner)
+	manager := orgRoleRequired(orgRoleOwner, orgRoleAdmin)
+
+	r.Get("/", a.handleIndex)
+	r.Get("/login", a.handleLoginPage)
+	r.Post("/login", a.handleLogin)
+	r.Post("/login/magic", a.handleMagicLinkRequest)
+	r.Get("/login/magic", a.handleMagicLinkLogin)
+	r.Get("/register", a.handleRegisterPage)
+	r.Post("/register", a.handleRegister)
+	r.Get("/register/confirm", a.handleRegisterConfirmPage)
+	r.Post("/register/confirm", a.handleRegisterConfirm)
+	r.Get("/password-policy", a.handlePasswordPolicy)
+	r.Get("/assets/:file", handleAsset)
+	r.Post("/language", a.handleLanguage)
+	r.Get("/dashboard", a.RequireAuth, a.handleDashboard)
+	r.Post("/logout", a.handleLogout)
+	r.Post("/account/password", a.RequireAuth, a.handleAccountPassword)
+	r.Post("/account/phone", a.RequireAuth, a.handleAccountPhone)
+	r.Post("/account/appearance", a.RequireAuth, a.handleAccountAppearance)
+	r.Get("/account/export", a.RequireAuth, a.handleAccountExport)
+	r.Post("/account/delete", a.RequireAuth, a.handleAccountDelete)
+	r.Post("/account/delete/cancel", a.RequireAuth, a.handleAccountDeleteCancel)
+	r.Post("/workspaces", a.RequireAuth, a.handleWorkspaceCreate)
+	r.Post("/workspaces/:id/switch", a.RequireAuth, a.handleWorkspaceSwitch)
+	r.Post("/workspace/rename", a.RequireAuth, manager, a.handleWorkspaceRename)
+	r.Post("/workspace/invitations", a.RequireAuth, manager, a.handleOrgInvitationCreate)
+	r.Post("/workspace/invitations/:id/revoke", a.RequireAuth, manager, a.handleOrgInvitationRevoke)
+	r.Post("/workspace/members/:userID/role", a.RequireAuth, owner, a.handleMemberRole)
+	r.Post("/workspace/members/:userID/remove", a.RequireAuth, manager, a.handleMemberRemove)
+	r.Post("/workspace/transfer", a.RequireAuth, owner, a.handleOwnershipTransfer)
+	r.Post("/workspace/leave", a.RequireAuth, a.handleWorkspaceLeave)
+	r.Post("/workspace-invitations/:id/accept", a.RequireAuth, a.handleOrgInvitationAccept)
+	r.Post("/workspace-invitations/:id/decline", a.RequireAuth, a.handleOrgInvitationDecline)
+	r.Post("/invitations", a.RequireAuth, a.handleInvitationCreate)
+	r.Post("/invitations/:id/revoke", a.RequireAuth, a.handleInvitationRevoke)
+	r.Post("/admin/webhooks", a.RequireAuth, adminRequired, a.handleWebhookCreate)
+	r.Post("/admin/webhooks/:id/test", a.RequireAuth, adminRequired, a.handleWebhookTest)
+	r.Post("/admin/webhooks/:id/delete", a.RequireAuth, adminRequired, a.handleWebhookDelete)
+	r.Post("/admin/webhooks/deliveries/:id/retry", a.RequireAuth, adminRequired, a.handleWebhookRetry)
+}
+
+// RequireAuth only lets signed-in users through, redirecting everyone else
+// to the login page. It makes the user and their current workspace
+// available to CurrentUser and CurrentMembership.
+func (a *Auth) RequireAuth(c *fiber.Ctx) error {
+	sess, err := a.loadSession(c)
+	if err != nil || sess.Get("userID") == nil {
+		return c.Redirect(a.path("/login"))
+	}
+
+	if reason := a.sessionExpired(sess); reason != "" {
+		a.dbFor(c).Where("session_id = ?", sess.ID()).Delete(&UserSession{})
+		sess.Destroy()
+		return c.Redirect(a.path("/login") + "?expired=" + reason)
+	}
+
+	var user User
+	if err := a.dbFor(c).First(&user, sess.Get("userID")).Error; err != nil {
+		sess.Destroy()
+		return c.Redirect(a.path("/login"))
+	}
+
+	if user.PasswordChangeRequired && c.Path() != a.path("/dashboard") && c.Path() != a.path("/account/password") {
+		return c.Redirect(a.path("/dashboard"))
+	}
+
+	membership, err := a.loadCurrentMembership(c.UserContext(), sess, user.ID)
+	if err != nil {
+		return fiber.ErrForbidden
+	}
+	a.touchSession(c, sess)
+
+	c.Locals(userKey, &user)
+	c.Locals(membershipKey, membership)
+	return c.Next()
+}
+
+// CurrentUser returns the signed-in user, or nil outside RequireAuth.
+func CurrentUser(c *fiber.Ctx) *User {
+	user, _ := c.Locals(userKey).(*User)
+	return user
+}
+
+// CurrentMembership returns the signed-in user's membership in their
+// selected workspace, or nil outside RequireAuth.
+func CurrentMembership(c *fiber.Ctx) *Membership {
+	m, _ := c.Locals(membershipKey).(*Membership)
+	return m
+}
+
+// requestLogger returns the module's logger annotated with the request's
+// X-Request-ID, trace ID and signed-in user, when known.
+func (a *Auth) requestLogger(c *fiber.Ctx) *slog.Logger {
+	l := a.logger
+	if id := c.GetRespHeader(fiber.HeaderXRequestID); id != "" {
+		l = l.With("request_id", id)
+	}
+	if user := CurrentUser(c); user != nil {
+		l = l.With("user_id", user.ID)
+	}
+	if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+		l = l.With("trace_id", sc.TraceID().String())
+	}
+	return l
+}
+
+// path returns the URL path of route under BasePath.
+func (a *Auth) path(route string) string {
+	return a.basePath + route
+}
+
+// url returns the absolute URL of route as seen by users, for links in
+// emails.
+func (a *Auth) url(route string) string {
+	return a.baseURL + a.path(route)
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testBaseURL = "http://auth.test"
+
+// testEnv is an Auth mounted on a Fiber app over a private in-memory
+// database, with mail captured in memory.
+type testEnv struct {
+	auth   *Auth
+	app    *fiber.App
+	mailer *MemoryMailer
+}
+
+// newTestEnv builds a testEnv. configure adjusts the Config, which starts
+// from DefaultConfig with argon2id made cheap enough for tests.
+func newTestEnv(t *testing.T, configure ...func(*Config)) *testEnv {
+	t.Helper()
+	db := openTestDB(t)
+
+	cfg := DefaultConfig()
+	cfg.Argon2id.Memory = 8 * 1024
+	cfg.Argon2id.Threads = 1
+	for _, f := range configure {
+		f(&cfg)
+	}
+	mailer := &MemoryMailer{}
+	a, err := New(Options{
+		DB:         db,
+		Store:      session.New(),
+		Mailer:     mailer,
+		BaseURL:    testBaseURL,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Config:     &cfg,
+		Registerer: prometheus.NewRegistry(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	a.Mount(app)
+	return &testEnv{auth: a, app: app, mailer: mailer}
+}
+
+// openTestDB returns an empty database: a private in-memory SQLite one, or
+// a fresh schema in the Postgres database AUTH_TEST_POSTGRES_DSN names.
+// Every connection to :memory: opens its own database, so the SQLite pool is
+// pinned to one.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	if dsn := os.Getenv("AUTH_TEST_POSTGRES_DSN"); dsn != "" {
+		return openTestPostgres(t, dsn)
+	}
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetConnMaxLifetime(0)
+	sqlDB.SetConnMaxIdleTime(0)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// openTestPostgres creates a schema for the test and returns a database
+// whose connections use it, dropping the schema when the test ends.
+func openTestPostgres(t *testing.T, dsn string) *gorm.DB {
+	t.Helper()
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminDB, err := admin.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := "auth_test_" + hashToken(randomToken(16))[:16]
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		adminDB.Close()
+	})
+
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		dsn = u.String()
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+// requireTimingTests skips wall-clock comparisons unless AUTH_TEST_TIMING
+// is set, since they flake on loaded machines.
+func requireTimingTests(t *testing.T) {
+	t.Helper()
+	if os.Getenv("AUTH_TEST_TIMING") == "" {
+		t.Skip("timing test; set AUTH_TEST_TIMING to run it")
+	}
+}
+
+// passwordHashes returns how many times passwords were hashed or verified,
+// depending on operation, with each algorithm.
+func (e *testEnv) passwordHashes(t *testing.T, operation string) map[string]uint64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 16)
+	go func() {
+		e.auth.metrics.passwordHashDuration.Collect(ch)
+		close(ch)
+	}()
+	counts := map[string]uint64{}
+	for m := range ch {
+		var out dto.Metric
+		if err := m.Write(&out); err != nil {
+			t.Fatal(err)
+		}
+		labels := map[string]string{}
+		for _, l := range out.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if labels["operation"] == operation {
+			counts[labels["algorithm"]] += out.GetHistogram().GetSampleCount()
+		}
+	}
+	return counts
+}
+
+// testClient is a browser: it keeps the cookies the app sets.
+type testClient struct {
+	t       *testing.T
+	env     *testEnv
+	cookies map[string]*http.Cookie
+}
+
+func (e *testEnv) client(t *testing.T) *testClient {
+	return &testClient{t: t, env: e, cookies: map[string]*http.Cookie{}}
+}
+
+// do sends a request, posting form when it is not nil, and returns the
+// response with its body read.
+func (c *testClient) do(method, target string, form url.Values) (*http.Response, string) {
+	c.t.Helper()
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req := httptest.NewRequest(method, target, body)
+	if form != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	}
+	for _, cookie := range c.cookies {
+		req.AddCookie(cookie)
+	}
+	resp, err := c.env.app.Test(req, -1)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Value == "" || (!cookie.Expires.IsZero() && cookie.Expires.Before(time.Now())) {
+			delete(c.cookies, cookie.Name)
+		} else {
+			c.cookies[cookie.Name] = cookie
+		}
+	}
+	return resp, string(b)
+}
+
+func (c *testClient) get(target string) (*http.Response, string) {
+	return c.do(http.MethodGet, target, nil)
+}
+
+func (c *testClient) post(target string, form url.Values) (*http.Response, string) {
+	return c.do(http.MethodPost, target, form)
+}
+
+// login signs in with a password and reports whether it worked.
+func (c *testClient) login(identifier, password string) bool {
+	c.t.Helper()
+	resp, _ := c.post("/login", url.Values{"identifier": {identifier}, "password": {password}})
+	return resp.StatusCode == fiber.StatusFound && resp.Header.Get(fiber.HeaderLocation) == "/dashboard"
+}
+
+// waitForMail waits for the nth message (counting from 1) sent to to.
+// Mail is sent in the background, so it may arrive after the response.
+func (e *testEnv) waitForMail(t *testing.T, to string, n int) Mail {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var found []Mail
+		for _, m := range e.mailer.Sent() {
+			if m.To == to {
+				found = append(found, m)
+			}
+		}
+		if len(found) >= n {
+			return found[n-1]
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d messages to %s, want %d", len(found), to, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// mailCount returns how many messages were sent to to so far.
+func (e *testEnv) mailCount(to string) int {
+	n := 0
+	for _, m := range e.mailer.Sent() {
+		if m.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+var mailLink = regexp.MustCompile(regexp.QuoteMeta(testBaseURL) + `(\S+)`)
+
+// linkIn returns the path and query of the first link to the app in m.
+func linkIn(t *testing.T, m Mail) string {
+	t.Helper()
+	match := mailLink.FindStringSubmatch(m.Body)
+	if match == nil {
+		t.Fatalf("no link in %q", m.Body)
+	}
+	return match[1]
+}
+
+// register submits the registration form.
+func (c *testClient) register(email, password string, extra url.Values) (*http.Response, string) {
+	form := url.Values{"email": {email}, "password": {password}, "confirm_password": {password}}
+	for k, v := range extra {
+		form[k] = v
+	}
+	return c.post("/register", form)
+}
+
+// registerUser registers email and confirms it from the emailed link,
+// leaving c signed in.
+func (e *testEnv) registerUser(t *testing.T, c *testClient, email, password string) *User {
+	t.Helper()
+	return e.registerWith(t, c, email, password, nil)
+}
+
+// registerWith is registerUser with extra form fields.
+func (e *testEnv) registerWith(t *testing.T, c *testClient, email, password string, extra url.Values) *User {
+	t.Helper()
+	before := e.mailCount(email)
+	c.register(email, password, extra)
+	link := linkIn(t, e.waitForMail(t, email, before+1))
+	resp, body := c.post(link, url.Values{"identifier": {email}, "password": {password}})
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("confirming %s: status %d\n%s", email, resp.StatusCode, body)
+	}
+	var user User
+	if err := e.auth.db.Where("email = ?", email).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+// createUser inserts an account directly, as one made before registration
+// required a confirmed address would be when verified is false.
+func (e *testEnv) createUser(t *testing.T, email, password string, verified bool) *User {
+	t.Helper()
+	_, normalized, err := e.auth.normalizeEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := e.auth.hashPassword(context.Background(), password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{Email: email, EmailNormalized: &normalized, Password: hash, Role: roleUser}
+	if verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	err = e.auth.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return createPersonalWorkspace(tx, &user)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BreachChecker reports whether a password appears in a known breach corpus.
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// loadBreachChecker opens the corpus cfg selects, or returns nil when
+// none is configured.
+func loadBreachChecker(cfg *Config, logger *slog.Logger) (BreachChecker, error) {
+	if dir := cfg.BreachedPasswordsRangeDir; dir != "" {
+		logger.Info("Breached password screening using range files", "dir", dir)
+		return rangeFileChecker{dir: dir}, nil
+	}
+	if path := cfg.BreachedPasswordsBloom; path != "" {
+		filter, err := loadBloomFilter(path)
+		if err != nil {
+			return nil, fmt.Errorf("auth: loading breached password bloom filter: %w", err)
+		}
+		logger.Info("Breached password screening using bloom filter", "path", path)
+		return filter, nil
+	}
+	return nil, nil
+}
+
+// isBreachedPassword fails open when the corpus cannot be read so an
+// unavailable file never locks users out.
+func (a *Auth) isBreachedPassword(password string) bool {
+	if a.breachChecker == nil {
+		return false
+	}
+	breached, err := a.breachChecker.IsBreached(password)
+	if err != nil {
+		a.logger.Warn("Breached password check failed", "error", err)
+		return false
+	}
+	return breached
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// rangeFileChecker reads HIBP-style range files: one file per 5 character
+// SHA-1 prefix (named "ABCDE" or "ABCDE.txt") holding "SUFFIX:COUNT" lines.
+type rangeFileChecker struct {
+	dir string
+}
+
+func (r rangeFileChecker) IsBreached(password string) (bool, error) {
+	hash := sha1Hex(password)
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(r.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(r.dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// bloomMagic starts every bloom filter file. It is followed by the number
+// of hash functions (uint32), the number of bits (uint64), both big-endian,
+// and then the bit array.
+const bloomMagic = "PWBLOOM1"
+
+// bloomFilter is a compact, probabilistic breach corpus. False positives
+// are possible, false negatives are not.
+type bloomFilter struct {
+	k    uint32
+	m    uint64
+	bits []byte
+}
+
+func newBloomFilter(n uint64, falsePositiveRate float64) *bloomFilter {
+	m, k := bloomSize(n, falsePositiveRate)
+	return &bloomFilter{k: k, m: m, bits: make([]byte, (m+7)/8)}
+}
+
+func (b *bloomFilter) indexes(sha1Digest []byte) []uint64 {
+	h1 := binary.BigEndian.Uint64(sha1Digest[0:8])
+	h2 := binary.BigEndian.Uint64(sha1Digest[8:16]) | 1
+	idx := make([]uint64, b.k)
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) % b.m
+	}
+	return idx
+}
+
+func (b *bloomFilter) addDigest(sha1Digest []byte) {
+	for _, i := range b.indexes(sha1Digest) {
+		b.bits[i/8] |= 1 << (i % 8)
+	}
+}
+
+func (b *bloomFilter) containsDigest(sha1Digest []byte) bool {
+	for _, i := range b.indexes(sha1Digest) {
+		if b.bits[i/8]&(1<<(i%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *bloomFilter) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	return b.containsDigest(sum[:]), nil
+}
+
+func (b *bloomFilter) writeTo(w io.Writer) error {
+	header := make([]byte, len(bloomMagic)+12)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[len(bloomMagic):], b.k)
+	binary.BigEndian.PutUint64(header[len(bloomMagic)+4:], b.m)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(b.bits)
+	return err
+}
+
+func loadBloomFilter(path string) (*bloomFilter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(bloomMagic)+12)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(bloomMagic)]) != bloomMagic {
+		return nil, fmt.Errorf("%s is not a bloom filter file", path)
+	}
+
+	b := &bloomFilter{
+		k: binary.BigEndian.Uint32(header[len(bloomMagic):]),
+		m: binary.BigEndian.Uint64(header[len(bloomMagic)+4:]),
+	}
+	if b.k == 0 || b.m == 0 {
+		return nil, fmt.Errorf("%s has an empty bloom filter header", path)
+	}
+	// Check the header against the file before trusting it with an
+	// allocation, so a corrupt one can't ask for more memory than the
+	// file could fill.
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if size := uint64(info.Size()) - uint64(len(header)); b.m > math.MaxUint64-7 || (b.m+7)/8 != size {
+		return nil, fmt.Errorf("%s holds %d bytes of bloom filter bits, its header says %d bits", path, size, b.m)
+	}
+	b.bits = make([]byte, (b.m+7)/8)
+	if _, err := io.ReadFull(f, b.bits); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// bloomSize returns the bit count and hash count for n entries at the
+// given false positive rate.
+func bloomSize(n uint64, p float64) (m uint64, k uint32) {
+	if n == 0 {
+		n = 1
+	}
+	// m = -n ln p / (ln 2)^2, k = m/n ln 2
+	const ln2 = 0.6931471805599453
+	m = uint64(-float64(n)*math.Log(p)/(ln2*ln2)) + 1
+	k = uint32(float64(m)/float64(n)*ln2 + 0.5)
+	if k == 0 {
+		k = 1
+	}
+	return m, k
+}
+
+// BuildBloomFilter converts a file of "SHA1HASH[:COUNT]" lines, such as the
+// HIBP "ordered by hash" download, into a bloom filter file.
+func BuildBloomFilter(inPath, outPath string, falsePositiveRate float64) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var n uint64
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	filter := newBloomFilter(n, falsePositiveRate)
+	scanner = bufio.NewScanner(in)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		digest, err := hex.DecodeString(hash)
+		if err != nil || len(digest) != sha1.Size {
+			continue
+		}
+		filter.addDigest(digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := filter.writeTo(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRangeFileChecker(t *testing.T) {
+	dir := t.TempDir()
+	// "password" hashes to 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8,
+	// "letmein" to B7A875FC1EA228B9061041B7CEC4BD3C52AB3CE3 and "password1"
+	// to a hash starting E38AD.
+	os.WriteFile(filepath.Join(dir, "5BAA6"), []byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1e4c9b93f3f0682250b6cf8331b7ee68fd8:9545824\r\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "B7A87.txt"), []byte("5FC1EA228B9061041B7CEC4BD3C52AB3CE3:1\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "E38AD"), []byte("00000000000000000000000000000000000:1\n"), 0o600)
+
+	checker := rangeFileChecker{dir: dir}
+	for _, tc := range []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"letmein", true},
+		{"Violet-Tractor-93-Lantern", false}, // no range file
+		{"password1", false},                 // range file without its suffix
+	} {
+		got, err := checker.IsBreached(tc.password)
+		if err != nil || got != tc.want {
+			t.Errorf("IsBreached(%q) = %v, %v; want %v", tc.password, got, err, tc.want)
+		}
+	}
+}
+
+func TestBloomFilterRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	var corpus strings.Builder
+	for _, p := range []string{"password", "letmein", "123456", "qwerty"} {
+		corpus.WriteString(sha1Hex(p) + ":42\n")
+	}
+	corpus.WriteString("not a hash\n")
+	in, out := filepath.Join(dir, "corpus.txt"), filepath.Join(dir, "breached.bloom")
+	os.WriteFile(in, []byte(corpus.String()), 0o600)
+
+	if err := BuildBloomFilter(in, out, 0.001); err != nil {
+		t.Fatal(err)
+	}
+	filter, err := loadBloomFilter(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"password", "letmein", "123456", "qwerty"} {
+		if ok, _ := filter.IsBreached(p); !ok {
+			t.Errorf("%q is missing from the filter", p)
+		}
+	}
+	if ok, _ := filter.IsBreached(testPassword); ok {
+		t.Errorf("%q is in the filter", testPassword)
+	}
+}
+
+func TestLoadBloomFilterRejectsCorruptFiles(t *testing.T) {
+	dir := t.TempDir()
+	header := func(k uint32, m uint64) []byte {
+		h := make([]byte, len(bloomMagic)+12)
+		copy(h, bloomMagic)
+		binary.BigEndian.PutUint32(h[len(bloomMagic):], k)
+		binary.BigEndian.PutUint64(h[len(bloomMagic)+4:], m)
+		return h
+	}
+	for name, contents := range map[string][]byte{
+		"bad magic":     append([]byte("NOTBLOOM"), header(3, 64)[len(bloomMagic):]...),
+		"short header":  header(3, 64)[:10],
+		"empty header":  header(0, 0),
+		"huge size":     append(header(3, 1<<62), make([]byte, 8)...),
+		"maximum size":  append(header(3, 1<<64-1), make([]byte, 8)...),
+		"truncated":     append(header(3, 64), make([]byte, 4)...),
+		"trailing data": append(header(3, 64), make([]byte, 16)...),
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "-"))
+		os.WriteFile(path, contents, 0o600)
+		if _, err := loadBloomFilter(path); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+}
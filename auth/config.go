@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config tunes registration, passwords, emailed links and webhooks.
+// DefaultConfig returns the defaults and ConfigFromEnv reads overrides from
+// the environment; start from either to change a few settings.
+type Config struct {
+	// RegistrationMode is "open", "invite-only" or "closed".
+	RegistrationMode string
+	// UsersCanInvite lets non-admin users create invitations too.
+	UsersCanInvite bool
+	// AdminEmails are given the admin role by Migrate.
+	AdminEmails []string
+	// EmailPlusFoldDomains lists domains where "user+tag@domain" delivers
+	// to "user@domain", so both are treated as the same account.
+	EmailPlusFoldDomains []string
+	// PhoneDefaultRegion is the ISO 3166-1 region assumed for numbers
+	// entered without a leading "+" and country code.
+	PhoneDefaultRegion string
+
+	// PasswordHashAlgorithm is "argon2id" or "bcrypt". Hashes in the other
+	// format still verify and are upgraded on login.
+	PasswordHashAlgorithm string
+	Argon2id              Argon2idHasher
+	Bcrypt                BcryptHasher
+	PasswordPolicy        PasswordPolicy
+	// BreachedPasswordsRangeDir or BreachedPasswordsBloom selects the
+	// corpus new passwords are screened against; both empty disables it.
+	BreachedPasswordsRangeDir string
+	BreachedPasswordsBloom    string
+	// ForceBreachedPasswordChange makes users whose current password is
+	// found in the corpus change it right after logging in.
+	ForceBreachedPasswordChange bool
+
+	// RegistrationLinkTTL is how long the link confirming a new account's
+	// email address works.
+	RegistrationLinkTTL time.Duration
+	// MagicLinkTTL is how long an emailed sign-in link works.
+	MagicLinkTTL time.Duration
+	// MagicLinkInterval is the least time between two sign-in links for
+	// the same account; requests in between send nothing.
+	MagicLinkInterval time.Duration
+	// OrgInvitationTTL is how long a workspace invitation can be accepted.
+	OrgInvitationTTL time.Duration
+	// AccountDeletionGrace is how long a deletion can be cancelled; zero
+	// deletes accounts right away.
+	AccountDeletionGrace time.Duration
+
+	WebhookTimeout     time.Duration
+	WebhookMaxAttempts int
+	WebhookRetryBase   time.Duration
+	WebhookRetryMax    time.Duration
+}
+
+// DefaultConfig returns the settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		RegistrationMode:      registrationOpen,
+		UsersCanInvite:        true,
+		PhoneDefaultRegion:    "US",
+		PasswordHashAlgorithm: "argon2id",
+		Argon2id:              Argon2idHasher{Memory: 64 * 1024, Iterations: 1, Threads: 4, SaltLength: 16, KeyLength: 32},
+		Bcrypt:                BcryptHasher{Cost: bcrypt.DefaultCost},
+		PasswordPolicy:        PasswordPolicy{MinLength: 8, MaxLength: 128, MinScore: 2, BlockedTerms: []string{"glassauth"}},
+		RegistrationLinkTTL:   24 * time.Hour,
+		MagicLinkTTL:          15 * time.Minute,
+		MagicLinkInterval:     time.Minute,
+		OrgInvitationTTL:      14 * 24 * time.Hour,
+		AccountDeletionGrace:  7 * 24 * time.Hour,
+		WebhookTimeout:        10 * time.Second,
+		WebhookMaxAttempts:    8,
+		WebhookRetryBase:      30 * time.Second,
+		WebhookRetryMax:       6 * time.Hour,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig with the environment variables
+// documented in the README applied.
+func ConfigFromEnv() (Config, error) {
+	cfg := DefaultConfig()
+	cfg.RegistrationMode = env.String("REGISTRATION_MODE", cfg.RegistrationMode)
+	cfg.UsersCanInvite = env.Bool("INVITES_ALLOW_USERS", cfg.UsersCanInvite)
+	cfg.AdminEmails = splitList(os.Getenv("ADMIN_EMAILS"))
+	cfg.EmailPlusFoldDomains = splitList(os.Getenv("EMAIL_PLUS_FOLD_DOMAINS"))
+	cfg.PhoneDefaultRegion = env.String("PHONE_DEFAULT_REGION", cfg.PhoneDefaultRegion)
+
+	cfg.PasswordHashAlgorithm = env.String("PASSWORD_HASH_ALGORITHM", cfg.PasswordHashAlgorithm)
+	cfg.Argon2id.Memory = uint32(env.Int("ARGON2_MEMORY_KIB", int(cfg.Argon2id.Memory)))
+	cfg.Argon2id.Iterations = uint32(env.Int("ARGON2_ITERATIONS", int(cfg.Argon2id.Iterations)))
+	cfg.Argon2id.Threads = uint8(env.Int("ARGON2_THREADS", int(cfg.Argon2id.Threads)))
+	cfg.Bcrypt.Cost = env.Int("BCRYPT_COST", cfg.Bcrypt.Cost)
+	cfg.PasswordPolicy.MinLength = env.Int("PASSWORD_MIN_LENGTH", cfg.PasswordPolicy.MinLength)
+	cfg.PasswordPolicy.MaxLength = env.Int("PASSWORD_MAX_LENGTH", cfg.PasswordPolicy.MaxLength)
+	cfg.PasswordPolicy.MinScore = env.Int("PASSWORD_MIN_SCORE", cfg.PasswordPolicy.MinScore)
+	if terms, ok := os.LookupEnv("PASSWORD_BLOCKED_TERMS"); ok {
+		cfg.PasswordPolicy.BlockedTerms = splitList(terms)
+	}
+	cfg.BreachedPasswordsRangeDir = os.Getenv("BREACHED_PASSWORDS_RANGE_DIR")
+	cfg.BreachedPasswordsBloom = os.Getenv("BREACHED_PASSWORDS_BLOOM")
+	cfg.ForceBreachedPasswordChange = env.Bool("BREACHED_PASSWORDS_FORCE_CHANGE", false)
+
+	cfg.RegistrationLinkTTL = env.Duration("REGISTRATION_LINK_TTL", cfg.RegistrationLinkTTL)
+	cfg.MagicLinkTTL = env.Duration("MAGIC_LINK_TTL", cfg.MagicLinkTTL)
+	cfg.MagicLinkInterval = env.Duration("MAGIC_LINK_INTERVAL", cfg.MagicLinkInterval)
+	cfg.OrgInvitationTTL = env.Duration("ORG_INVITATION_TTL", cfg.OrgInvitationTTL)
+	cfg.AccountDeletionGrace = env.Duration("ACCOUNT_DELETION_GRACE", cfg.AccountDeletionGrace)
+
+	cfg.WebhookTimeout = env.Duration("WEBHOOK_TIMEOUT", cfg.WebhookTimeout)
+	cfg.WebhookMaxAttempts = env.Int("WEBHOOK_MAX_ATTEMPTS", cfg.WebhookMaxAttempts)
+	cfg.WebhookRetryBase = env.Duration("WEBHOOK_RETRY_BASE", cfg.WebhookRetryBase)
+	cfg.WebhookRetryMax = env.Duration("WEBHOOK_RETRY_MAX", cfg.WebhookRetryMax)
+	return cfg, cfg.validate()
+}
+
+// validate normalizes the settings and rejects ones the module can't run
+// with.
+func (cfg *Config) validate() error {
+	switch cfg.RegistrationMode {
+	case registrationOpen, registrationInviteOnly, registrationClosed:
+	default:
+		return fmt.Errorf("auth: unknown registration mode %q, want open, invite-only or closed", cfg.RegistrationMode)
+	}
+	if cfg.PasswordHashAlgorithm != "argon2id" && cfg.PasswordHashAlgorithm != "bcrypt" {
+		return fmt.Errorf("auth: unknown password hash algorithm %q, want argon2id or bcrypt", cfg.PasswordHashAlgorithm)
+	}
+	cfg.PhoneDefaultRegion = strings.ToUpper(cfg.PhoneDefaultRegion)
+
+	p := &cfg.PasswordPolicy
+	// Lowercase into a new slice: the caller's may be shared.
+	terms := make([]string, len(p.BlockedTerms))
+	for i, term := range p.BlockedTerms {
+		terms[i] = strings.ToLower(term)
+	}
+	p.BlockedTerms = terms
+	if p.CommonWords == nil {
+		p.CommonWords = commonPasswordWords
+	}
+	// bcrypt silently ignores everything past 72 bytes.
+	if cfg.PasswordHashAlgorithm == "bcrypt" {
+		p.MaxLength = min(p.MaxLength, 72)
+		if p.MaxBytes == 0 || p.MaxBytes > 72 {
+			p.MaxBytes = 72
+		}
+	}
+	if p.MinLength > p.MaxLength {
+		return fmt.Errorf("auth: password minimum length %d exceeds the maximum %d", p.MinLength, p.MaxLength)
+	}
+	if cfg.WebhookMaxAttempts < 1 {
+		return fmt.Errorf("auth: webhook attempts must be at least 1, got %d", cfg.WebhookMaxAttempts)
+	}
+	return nil
+}
+
+// hashers returns every supported hasher, the configured one first.
+func (cfg *Config) hashers() []PasswordHasher {
+	if cfg.PasswordHashAlgorithm == "bcrypt" {
+		return []PasswordHasher{cfg.Bcrypt, cfg.Argon2id}
+	}
+	return []PasswordHasher{cfg.Argon2id, cfg.Bcrypt}
+}
+
+// splitList splits a comma-separated list, dropping blank entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
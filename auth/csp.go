@@ -0,0 +1,30 @@
+package auth
+
+import "github.com/gofiber/fiber/v2"
+
+// CSPNonce returns the request's Content-Security-Policy nonce, creating
+// it on first use. Every inline script and style on the pages carries it,
+// so a policy allowing only 'nonce-<value>' lets them run.
+func CSPNonce(c *fiber.Ctx) string {
+	if nonce, ok := c.Locals(nonceKey).(string); ok {
+		return nonce
+	}
+	nonce := randomToken(16)
+	c.Locals(nonceKey, nonce)
+	return nonce
+}
+
+// FramingDenied reports whether the response must not be framed by any
+// site, whatever the configured policy. It is set on pages with
+// credential forms to protect them from clickjacking.
+func FramingDenied(c *fiber.Ctx) bool {
+	denied, _ := c.Locals(framingDeniedKey).(bool)
+	return denied
+}
+
+// denyFraming marks the response as never frameable and sends
+// X-Frame-Options for browsers without frame-ancestors support.
+func denyFraming(c *fiber.Ctx) {
+	c.Locals(framingDeniedKey, true)
+	c.Set(fiber.HeaderXFrameOptions, "DENY")
+}
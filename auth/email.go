@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"gorm.io/gorm"
+)
+
+var errInvalidEmail = errors.New("invalid email address")
+
+// plusFoldDomainSet returns the ASCII forms of domains as a set.
+func plusFoldDomainSet(domains []string) map[string]bool {
+	set := map[string]bool{}
+	for _, d := range domains {
+		if ascii, err := idna.Lookup.ToASCII(strings.ToLower(strings.TrimSpace(d))); err == nil && ascii != "" {
+			set[ascii] = true
+		}
+	}
+	return set
+}
+
+// normalizeEmail validates raw as a single RFC 5322 addr-spec with an
+// IDNA-valid domain. It returns the address to store and display, with
+// surrounding space trimmed and the domain lowercased, and the normalized
+// form used for lookups and uniqueness: local part case-folded, domain in
+// ASCII (punycode), and plus tags removed for Config.EmailPlusFoldDomains.
+func (a *Auth) normalizeEmail(raw string) (address, normalized string, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > 254 {
+		return "", "", errInvalidEmail
+	}
+
+	// Reject display names ("Bob <bob@example.com>") and anything else
+	// that isn't a bare address.
+	parsed, err := mail.ParseAddress(raw)
+	if err != nil || parsed.Name != "" || parsed.Address != raw {
+		return "", "", errInvalidEmail
+	}
+
+	at := strings.LastIndex(raw, "@")
+	local, domain := raw[:at], raw[at+1:]
+	if len(local) > 64 || strings.HasPrefix(local, `"`) {
+		return "", "", errInvalidEmail
+	}
+
+	asciiDomain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || !strings.Contains(asciiDomain, ".") || len(asciiDomain) > 253 {
+		return "", "", errInvalidEmail
+	}
+	unicodeDomain, err := idna.Lookup.ToUnicode(asciiDomain)
+	if err != nil {
+		return "", "", errInvalidEmail
+	}
+
+	foldedLocal := strings.ToLower(local)
+	if a.plusFoldDomains[asciiDomain] {
+		foldedLocal, _, _ = strings.Cut(foldedLocal, "+")
+		if foldedLocal == "" {
+			return "", "", errInvalidEmail
+		}
+	}
+
+	return local + "@" + unicodeDomain, foldedLocal + "@" + asciiDomain, nil
+}
+
+// findUserByEmail looks a user up by the normalized form of email.
+// Rows the backfill could not normalize are still found by exact match.
+func (a *Auth) findUserByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	if _, normalized, err := a.normalizeEmail(email); err == nil {
+		if err := a.db.WithContext(ctx).Where("email_normalized = ?", normalized).First(&user).Error; err == nil {
+			return &user, nil
+		}
+	}
+	if err := a.db.WithContext(ctx).Where("email = ? AND email_normalized IS NULL", strings.TrimSpace(email)).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// backfillNormalizedEmails fills email_normalized for rows created before
+// the column existed. Rows whose email is invalid or collides with another
+// account's normalized email are left as they are and logged.
+func (a *Auth) backfillNormalizedEmails() {
+	var users []User
+	a.db.Where("email_normalized IS NULL OR email_normalized = ''").Find(&users)
+	backfilled := 0
+	for _, u := range users {
+		_, normalized, err := a.normalizeEmail(u.Email)
+		if err != nil {
+			a.logger.Warn("Invalid email address, leaving it unnormalized", "user_id", u.ID)
+			a.db.Model(&u).Update("email_normalized", gorm.Expr("NULL"))
+			continue
+		}
+
+		var other int64
+		a.db.Model(&User{}).Where("email_normalized = ? AND id <> ?", normalized, u.ID).Count(&other)
+		if other > 0 {
+			a.logger.Warn("Email address collides with an existing account, leaving it unnormalized", "user_id", u.ID)
+			a.db.Model(&u).Update("email_normalized", gorm.Expr("NULL"))
+			continue
+		}
+		a.db.Model(&u).Update("email_normalized", normalized)
+		backfilled++
+	}
+	if backfilled > 0 {
+		a.logger.Info("Backfilled normalized emails", "users", backfilled)
+	}
+}
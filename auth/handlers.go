@@ -0,0 +1,1796 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type User struct {
+	ID    uint   `gorm:"primaryKey" json:"id"`
+	Email string `gorm:"uniqueIndex;size:255;not null" json:"email"`
+	// EmailNormalized is nil only for legacy rows the backfill could not normalize.
+	EmailNormalized *string `gorm:"uniqueIndex;size:255" json:"-"`
+	// EmailVerifiedAt is when the user last proved they read mail for
+	// Email; nil for accounts created before verification existed.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	Phone           string     `gorm:"size:40" json:"phone"`
+	PhoneE164       *string    `gorm:"uniqueIndex;size:16" json:"phone_e164,omitempty"`
+	Password        string     `gorm:"not null" json:"-"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	DeleteAfter     *time.Time `json:"delete_after,omitempty"`
+
+	PasswordChangeRequired bool   `json:"password_change_required"`
+	Role                   string `gorm:"size:32;not null;default:user" json:"role"`
+	// Locale is the language picked with the switcher, empty to follow
+	// the browser.
+	Locale string `gorm:"size:16" json:"locale"`
+	// ColorScheme is "light", "dark" or empty for the theme's default.
+	ColorScheme string `gorm:"size:8" json:"color_scheme"`
+}
+
+// SeedDemoUser creates the demo account when the database has no users yet
+// and shows its credentials on the login page. Call it after Migrate.
+func (a *Auth) SeedDemoUser() {
+	a.demo = true
+	var count int64
+	a.db.Model(&User{}).Count(&count)
+	if count == 0 {
+		hash, _ := a.hashPassword(context.Background(), "demo2024")
+		email, normalized, _ := a.normalizeEmail("demo@glassauth.io")
+		phone, phoneE164, _ := a.normalizePhone("+1 (555) 987-6543")
+		now := time.Now()
+		demo := User{
+			Email:           email,
+			EmailNormalized: &normalized,
+			EmailVerifiedAt: &now,
+			Phone:           phone,
+			PhoneE164:       &phoneE164,
+			Password:        hash,
+		}
+		a.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&demo).Error; err != nil {
+				return err
+			}
+			return createPersonalWorkspace(tx, &demo)
+		})
+		a.promoteAdmins()
+		a.logger.Info("Demo user created", "email", "demo@glassauth.io")
+	}
+}
+
+func (a *Auth) handleIndex(c *fiber.Ctx) error {
+	return c.Redirect(a.path("/login"))
+}
+
+func (a *Auth) handleLoginPage(c *fiber.Ctx) error {
+	notice := ""
+	switch c.Query("expired") {
+	case expiredIdle:
+		notice = a.localizer(c).H("login.session_idle")
+	case expiredAbsolute:
+		notice = a.localizer(c).H("login.session_expired")
+	}
+	c.Type("html")
+	return c.SendString(a.renderLoginPage(c, "", notice))
+}
+
+func (a *Auth) handleLogin(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	identifier := c.FormValue("identifier")
+	if identifier == "" {
+		identifier = c.FormValue("email")
+	}
+	password := c.FormValue("password")
+
+	user, err := a.findUserByIdentifier(c.UserContext(), identifier)
+	if err != nil {
+		// Do the same work as for a wrong password so response times don't
+		// reveal which emails have accounts.
+		a.verifyPassword(c.UserContext(), a.dummyHashFor(identifier), password)
+		a.metrics.loginFailuresTotal.WithLabelValues(loginFailureUnknownAccount).Inc()
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("login.invalid_credentials"), ""))
+	}
+
+	ok, needsRehash, err := a.verifyPassword(c.UserContext(), user.Password, password)
+	if err != nil || !ok {
+		a.recordAuthEventInBackground(c, user.ID, eventLoginFailed)
+		a.metrics.loginFailuresTotal.WithLabelValues(loginFailureWrongPassword).Inc()
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("login.invalid_credentials"), ""))
+	}
+
+	if needsRehash {
+		if hash, err := a.hashPassword(c.UserContext(), password); err == nil {
+			a.dbFor(c).Model(user).Update("password", hash)
+		}
+	}
+
+	event := newHookEvent(c, ActionLogin, user)
+	event.Method = "password"
+	if err := a.before(c, event); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, html.EscapeString(err.Error()), ""))
+	}
+
+	if a.cfg.ForceBreachedPasswordChange && a.isBreachedPassword(password) {
+		a.dbFor(c).Model(user).Update("password_change_required", true)
+	}
+
+	if err := a.signIn(c, user); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("login.failed"), ""))
+	}
+	a.recordAuthEvent(c, user.ID, eventLogin)
+	a.metrics.loginsTotal.WithLabelValues("password").Inc()
+	a.after(c.UserContext(), event)
+
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleRegisterPage(c *fiber.Ctx) error {
+	c.Type("html")
+	return c.SendString(a.renderRegisterPage(c, "", c.Query("invite"), c.Query("workspace_invite")))
+}
+
+func (a *Auth) handleRegister(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	email, normalizedEmail, err := a.normalizeEmail(c.FormValue("email"))
+	password := c.FormValue("password")
+	confirmPassword := c.FormValue("confirm_password")
+	inviteCode := strings.TrimSpace(c.FormValue("invite_code"))
+	workspaceToken := c.FormValue("workspace_invite")
+
+	if a.cfg.RegistrationMode == registrationClosed {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, l.H("register.closed"), "", ""))
+	}
+
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, l.H("register.invalid_email"), inviteCode, workspaceToken))
+	}
+
+	if reasons := a.validateNewPassword(l, password, confirmPassword, email); len(reasons) > 0 {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, reasonsHTML(reasons), inviteCode, workspaceToken))
+	}
+
+	var invitation *Invitation
+	var orgInvitation *OrgInvitation
+	switch {
+	case inviteCode != "":
+		invitation, err = a.findInvitation(inviteCode, normalizedEmail)
+	case a.cfg.RegistrationMode == registrationInviteOnly && workspaceToken != "":
+		// People invited into a workspace register from the link in their
+		// invitation instead of with a code.
+		if orgInvitation = a.orgInvitationByToken(workspaceToken); orgInvitation == nil {
+			err = errInvalidInvite
+		} else if orgInvitation.EmailNormalized != normalizedEmail {
+			err = errInviteOtherEmail
+		}
+	case a.cfg.RegistrationMode == registrationInviteOnly:
+		invitation, err = a.findInvitation(inviteCode, normalizedEmail)
+	}
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, html.EscapeString(l.Err(err)), inviteCode, workspaceToken))
+	}
+
+	event := newHookEvent(c, ActionRegister, nil)
+	event.Email = email
+	if err := a.before(c, event); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, html.EscapeString(err.Error()), inviteCode, workspaceToken))
+	}
+
+	// Hash before looking the email up so both outcomes cost the same.
+	hash, err := a.hashPassword(c.UserContext(), password)
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, l.H("register.failed"), inviteCode, workspaceToken))
+	}
+
+	var existing User
+	if a.dbFor(c).Where("email_normalized = ?", normalizedEmail).First(&existing).Error == nil {
+		ml := a.mailLocalizer(c, &existing)
+		a.sendMail(Mail{
+			To:      existing.Email,
+			Subject: ml.T("mail.register_taken.subject"),
+			Body:    ml.T("mail.register_taken.body", a.theme.ProductName, a.url("/login")),
+		})
+	} else if err := a.startRegistration(c, email, normalizedEmail, hash, invitation, orgInvitation); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderRegisterPage(c, l.H("register.failed"), inviteCode, workspaceToken))
+	}
+
+	// Respond the same way whether or not the email was already registered;
+	// the account only exists once the emailed link is confirmed.
+	c.Type("html")
+	return c.SendString(a.renderLoginPage(c, "", l.H("register.check_inbox", email)))
+}
+
+func (a *Auth) handleDashboard(c *fiber.Ctx) error {
+	c.Type("html")
+	return c.SendString(a.renderDashboard(c, "", ""))
+}
+
+func (a *Auth) handleLogout(c *fiber.Ctx) error {
+	sess, _ := a.loadSession(c)
+	userID, ok := sess.Get("userID").(uint)
+	if !ok {
+		sess.Destroy()
+		return c.Redirect(a.path("/login"))
+	}
+
+	var user User
+	hooked := len(a.hooks) > 0 && a.dbFor(c).First(&user, userID).Error == nil
+	event := newHookEvent(c, ActionLogout, &user)
+	if hooked {
+		// Signing out must always work, so a veto is only logged.
+		_ = a.before(c, event)
+	}
+
+	a.recordAuthEvent(c, userID, eventLogout)
+	a.metrics.logoutsTotal.Inc()
+	a.dbFor(c).Where("session_id = ?", sess.ID()).Delete(&UserSession{})
+	// Drop the signed-in session and hand the browser a new, empty one.
+	if err := sess.Reset(); err == nil {
+		a.saveSession(c, sess)
+	}
+	if hooked {
+		a.after(c.UserContext(), event)
+	}
+	return c.Redirect(a.path("/login"))
+}
+
+func (a *Auth) renderLoginPage(c *fiber.Ctx, errorMsg, noticeMsg string) string {
+	return a.renderLoginPageFor(c, a.path("/login"), errorMsg, noticeMsg)
+}
+
+// renderLoginPageFor renders the login page with its password form posting
+// to action.
+func (a *Auth) renderLoginPageFor(c *fiber.Ctx, action, errorMsg, noticeMsg string) string {
+	l := a.localizer(c)
+	nonce := CSPNonce(c)
+	denyFraming(c)
+
+	errorHTML := ""
+	if errorMsg != "" {
+		errorHTML = fmt.Sprintf(`<div class="error-shake bg-red-500/20 border border-red-500/50 text-red-200 px-4 py-3 rounded-xl mb-6 backdrop-blur-sm">%s</div>`, errorMsg)
+	} else if noticeMsg != "" {
+		errorHTML = fmt.Sprintf(`<div class="bg-emerald-500/20 border border-emerald-500/50 text-emerald-200 px-4 py-3 rounded-xl mb-6 backdrop-blur-sm">%s</div>`, noticeMsg)
+	}
+
+	demoHTML := ""
+	if a.demo {
+		demoHTML = fmt.Sprintf(`<div class="demo-hint">
+                <p>🔐 %s: <code>demo@glassauth.io</code> / <code>demo2024</code></p>
+                <p>📱 %s: <code dir="ltr">+1 (555) 987-6543</code></p>
+            </div>`, html.EscapeString(l.T("login.demo")), html.EscapeString(l.T("login.demo_phone")))
+	}
+
+	return fmt.Sprintf(l.Page(`<!DOCTYPE html>
+<html lang="{{lang}}" dir="{{dir}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{login.page_title}} | %s</title>
+    <link rel="stylesheet" href="%s">
+    %s
+    <style nonce="%s">
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        
+        body {
+            min-height: 100vh;
+            background: var(--background);
+            overflow: hidden;
+            font-family: var(--font);
+        }
+
+        .scene {
+            perspective: 1500px;
+            perspective-origin: 50%% 50%%;
+            position: fixed;
+            inset: 0;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+        }
+
+        .floating-shapes {
+            position: fixed;
+            inset: 0;
+            pointer-events: none;
+            overflow: hidden;
+        }
+
+        .shape {
+            position: absolute;
+            border-radius: 50%%;
+            background: linear-gradient(135deg, rgba(var(--primary-rgb), 0.3), rgba(var(--secondary-rgb), 0.3));
+            filter: blur(1px);
+            animation: float 20s infinite ease-in-out;
+        }
+
+        .shape:nth-child(1) { width: 300px; height: 300px; top: -150px; left: 10%%; animation-delay: 0s; }
+        .shape:nth-child(2) { width: 200px; height: 200px; top: 60%%; right: -100px; animation-delay: -5s; background: linear-gradient(135deg, rgba(var(--accent-rgb), 0.3), rgba(239, 68, 68, 0.3)); }
+        .shape:nth-child(3) { width: 150px; height: 150px; bottom: -75px; left: 30%%; animation-delay: -10s; background: linear-gradient(135deg, rgba(var(--secondary-rgb), 0.3), rgba(var(--highlight-rgb), 0.3)); }
+        .shape:nth-child(4) { width: 250px; height: 250px; top: 20%%; right: 20%%; animation-delay: -15s; }
+        .shape:nth-child(5) { width: 180px; height: 180px; bottom: 20%%; left: -90px; animation-delay: -7s; background: linear-gradient(135deg, rgba(251, 191, 36, 0.3), rgba(245, 158, 11, 0.3)); }
+
+        @keyframes float {
+            0%%, 100%% { transform: translate(0, 0) rotate(0deg) scale(1); }
+            25%% { transform: translate(30px, -30px) rotate(90deg) scale(1.1); }
+            50%% { transform: translate(-20px, 20px) rotate(180deg) scale(0.9); }
+            75%% { transform: translate(40px, 10px) rotate(270deg) scale(1.05); }
+        }
+
+        .geometric-grid {
+            position: fixed;
+            inset: 0;
+            background-image: 
+                linear-gradient(rgba(var(--primary-rgb), 0.03) 1px, transparent 1px),
+                linear-gradient(90deg, rgba(var(--primary-rgb), 0.03) 1px, transparent 1px);
+            background-size: 50px 50px;
+            transform: perspective(500px) rotateX(60deg);
+            transform-origin: center top;
+            animation: gridMove 20s linear infinite;
+        }
+
+        @keyframes gridMove {
+            0%% { background-position: 0 0; }
+            100%% { background-position: 50px 50px; }
+        }
+
+        .cube-container {
+            position: fixed;
+            width: 100px;
+            height: 100px;
+            transform-style: preserve-3d;
+            animation: rotateCube 25s infinite linear;
+        }
+
+        .cube-container.left { left: 10%%; top: 30%%; }
+        .cube-container.right { right: 10%%; bottom: 30%%; animation-direction: reverse; }
+
+        .cube-face {
+            position: absolute;
+            width: 100px;
+            height: 100px;
+            border: 2px solid rgba(var(--primary-rgb), 0.3);
+            background: rgba(var(--primary-rgb), 0.05);
+            backdrop-filter: blur(5px);
+        }
+
+        .cube-face:nth-child(1) { transform: rotateY(0deg) translateZ(50px); }
+        .cube-face:nth-child(2) { transform: rotateY(180deg) translateZ(50px); }
+        .cube-face:nth-child(3) { transform: rotateY(90deg) translateZ(50px); }
+        .cube-face:nth-child(4) { transform: rotateY(-90deg) translateZ(50px); }
+        .cube-face:nth-child(5) { transform: rotateX(90deg) translateZ(50px); }
+        .cube-face:nth-child(6) { transform: rotateX(-90deg) translateZ(50px); }
+
+        @keyframes rotateCube {
+            0%% { transform: rotateX(0deg) rotateY(0deg); }
+            100%% { transform: rotateX(360deg) rotateY(360deg); }
+        }
+
+        .glass-card {
+            width: 420px;
+            padding: 3rem;
+            background: rgba(var(--fg-rgb), 0.03);
+            backdrop-filter: blur(20px);
+            border-radius: 24px;
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            box-shadow: 
+                0 25px 50px -12px rgba(0, 0, 0, 0.5),
+                0 0 0 1px rgba(var(--fg-rgb), 0.05) inset,
+                0 -20px 40px -20px rgba(var(--primary-rgb), 0.3) inset;
+            transform-style: preserve-3d;
+            transform: rotateX(5deg) rotateY(0deg);
+            transition: transform 0.1s ease-out;
+            animation: cardEntrance 1s ease-out;
+        }
+
+        @keyframes cardEntrance {
+            0%% { opacity: 0; transform: rotateX(20deg) rotateY(-20deg) translateZ(-100px); }
+            100%% { opacity: 1; transform: rotateX(5deg) rotateY(0deg) translateZ(0); }
+        }
+
+        .card-glow {
+            position: absolute;
+            inset: -2px;
+            background: linear-gradient(135deg, rgba(var(--primary-rgb), 0.5), rgba(var(--secondary-rgb), 0.5), rgba(var(--accent-rgb), 0.5));
+            border-radius: 26px;
+            z-index: -1;
+            filter: blur(20px);
+            opacity: 0.5;
+            animation: glowPulse 3s ease-in-out infinite;
+        }
+
+        @keyframes glowPulse {
+            0%%, 100%% { opacity: 0.3; transform: scale(1); }
+            50%% { opacity: 0.6; transform: scale(1.02); }
+        }
+
+        .form-title {
+            font-size: 2rem;
+            font-weight: 700;
+            text-align: center;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, var(--heading) 0%%, var(--primary-light) 50%%, var(--secondary-light) 100%%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+            background-clip: text;
+            text-shadow: 0 0 40px rgba(var(--primary-rgb), 0.5);
+        }
+
+        .form-subtitle {
+            text-align: center;
+            color: rgba(var(--fg-rgb), 0.5);
+            margin-bottom: 2rem;
+            font-size: 0.9rem;
+        }
+
+        .input-group {
+            position: relative;
+            margin-bottom: 1.5rem;
+        }
+
+        .input-group label {
+            display: block;
+            color: rgba(var(--fg-rgb), 0.7);
+            font-size: 0.85rem;
+            margin-bottom: 0.5rem;
+            font-weight: 500;
+        }
+
+        .input-group input {
+            width: 100%%;
+            padding: 1rem 1.25rem;
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 12px;
+            color: var(--fg);
+            font-size: 1rem;
+            transition: all 0.3s ease;
+            outline: none;
+        }
+
+        .input-group input:focus {
+            border-color: rgba(var(--primary-rgb), 0.5);
+            background: rgba(var(--fg-rgb), 0.08);
+            box-shadow: 0 0 20px rgba(var(--primary-rgb), 0.2);
+        }
+
+        .input-group input::placeholder {
+            color: rgba(var(--fg-rgb), 0.3);
+        }
+
+        .submit-btn {
+            width: 100%%;
+            padding: 1rem;
+            background: linear-gradient(135deg, var(--primary) 0%%, var(--primary-blend) 50%%, var(--secondary) 100%%);
+            border: none;
+            border-radius: 12px;
+            color: white;
+            font-size: 1rem;
+            font-weight: 600;
+            cursor: pointer;
+            transition: all 0.3s ease;
+            position: relative;
+            overflow: hidden;
+            margin-top: 1rem;
+        }
+
+        .submit-btn::before {
+            content: '';
+            position: absolute;
+            inset: 0;
+            background: linear-gradient(135deg, transparent, rgba(255, 255, 255, 0.2), transparent);
+            transform: translateX(-100%%);
+            transition: transform 0.5s ease;
+        }
+
+        .submit-btn:hover {
+            transform: translateY(-2px);
+            box-shadow: 0 10px 30px rgba(var(--primary-rgb), 0.4);
+        }
+
+        .submit-btn:hover::before {
+            transform: translateX(100%%);
+        }
+
+        .submit-btn:active {
+            transform: translateY(0);
+        }
+
+        .magic-link-btn {
+            width: 100%%;
+            padding: 0.85rem;
+            margin-top: 0.75rem;
+            background: rgba(var(--fg-rgb), 0.03);
+            border: 1px solid rgba(var(--primary-rgb), 0.3);
+            border-radius: 12px;
+            color: var(--primary-lighter);
+            font-size: 0.95rem;
+            font-weight: 500;
+            cursor: pointer;
+            transition: all 0.3s ease;
+        }
+
+        .magic-link-btn:hover {
+            background: rgba(var(--primary-rgb), 0.1);
+            border-color: rgba(var(--primary-rgb), 0.5);
+        }
+
+        .alt-action {
+            text-align: center;
+            margin-top: 1.5rem;
+            color: rgba(var(--fg-rgb), 0.5);
+            font-size: 0.9rem;
+        }
+
+        .alt-action a {
+            color: var(--primary-light);
+            text-decoration: none;
+            font-weight: 500;
+            transition: color 0.3s ease;
+        }
+
+        .alt-action a:hover {
+            color: var(--primary-lighter);
+            text-decoration: underline;
+        }
+
+        .demo-hint {
+            margin-top: 1.5rem;
+            padding: 1rem;
+            background: rgba(var(--primary-rgb), 0.1);
+            border-radius: 12px;
+            border: 1px solid rgba(var(--primary-rgb), 0.2);
+        }
+
+        .demo-hint p {
+            color: rgba(var(--fg-rgb), 0.6);
+            font-size: 0.8rem;
+            margin: 0;
+        }
+
+        .demo-hint p + p {
+            margin-top: 0.5rem;
+        }
+
+        .demo-hint code {
+            color: var(--primary-light);
+            background: rgba(var(--primary-rgb), 0.2);
+            padding: 0.1rem 0.4rem;
+            border-radius: 4px;
+            font-size: 0.75rem;
+        }
+
+        .particles {
+            position: fixed;
+            inset: 0;
+            pointer-events: none;
+        }
+
+        .particle {
+            position: absolute;
+            width: 4px;
+            height: 4px;
+            background: rgba(var(--primary-rgb), 0.6);
+            border-radius: 50%%;
+            animation: particleFloat 15s infinite linear;
+        }
+
+        @keyframes particleFloat {
+            0%% { transform: translateY(100vh) rotate(0deg); opacity: 0; }
+            10%% { opacity: 1; }
+            90%% { opacity: 1; }
+            100%% { transform: translateY(-100vh) rotate(720deg); opacity: 0; }
+        }
+
+        .error-shake {
+            animation: shake 0.5s ease-in-out;
+        }
+
+        @keyframes shake {
+            0%%, 100%% { transform: translateX(0); }
+            20%% { transform: translateX(-10px); }
+            40%% { transform: translateX(10px); }
+            60%% { transform: translateX(-10px); }
+            80%% { transform: translateX(10px); }
+        }
+
+        .torus {
+            position: fixed;
+            width: 200px;
+            height: 200px;
+            border: 30px solid transparent;
+            border-radius: 50%%;
+            border-top-color: rgba(var(--primary-rgb), 0.2);
+            border-bottom-color: rgba(var(--secondary-rgb), 0.2);
+            animation: spinTorus 10s linear infinite;
+        }
+
+        .torus.one { top: 5%%; left: 5%%; }
+        .torus.two { bottom: 5%%; right: 5%%; animation-direction: reverse; border-top-color: rgba(var(--accent-rgb), 0.2); }
+
+        @keyframes spinTorus {
+            0%% { transform: rotateX(45deg) rotateZ(0deg); }
+            100%% { transform: rotateX(45deg) rotateZ(360deg); }
+        }
+
+        .brand {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            gap: 0.5rem;
+            margin-bottom: 1rem;
+            color: rgba(var(--fg-rgb), 0.6);
+            font-size: 0.85rem;
+            font-weight: 600;
+            letter-spacing: 0.05em;
+        }
+
+        .brand-logo { height: 28px; width: auto; }
+
+        .language-switcher {
+            position: absolute;
+            top: 1rem;
+            inset-inline-end: 1rem;
+        }
+
+        .language-switcher select {
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 8px;
+            color: rgba(var(--fg-rgb), 0.7);
+            font-size: 0.75rem;
+            padding: 0.25rem 0.5rem;
+            cursor: pointer;
+        }
+
+        .language-switcher option { color: var(--fg); background: var(--surface); }
+
+        /* Mirror the scene for right-to-left languages. */
+        [dir="rtl"] .shape:nth-child(1) { left: auto; right: 10%%; }
+        [dir="rtl"] .shape:nth-child(2) { right: auto; left: -100px; }
+        [dir="rtl"] .shape:nth-child(3) { left: auto; right: 30%%; }
+        [dir="rtl"] .shape:nth-child(4) { right: auto; left: 20%%; }
+        [dir="rtl"] .shape:nth-child(5) { left: auto; right: -90px; }
+        [dir="rtl"] .cube-container.left { left: auto; right: 10%%; }
+        [dir="rtl"] .cube-container.right { right: auto; left: 10%%; }
+        [dir="rtl"] .torus.one { left: auto; right: 5%%; }
+        [dir="rtl"] .torus.two { right: auto; left: 5%%; }
+        [dir="rtl"] .glass-card { animation-name: cardEntranceRtl; }
+        [dir="rtl"] .submit-btn::before { transform: translateX(100%%); }
+        [dir="rtl"] .submit-btn:hover::before { transform: translateX(-100%%); }
+
+        @keyframes cardEntranceRtl {
+            0%% { opacity: 0; transform: rotateX(20deg) rotateY(20deg) translateZ(-100px); }
+            100%% { opacity: 1; transform: rotateX(5deg) rotateY(0deg) translateZ(0); }
+        }
+    </style>
+</head>
+<body>
+    <div class="floating-shapes">
+        <div class="shape"></div>
+        <div class="shape"></div>
+        <div class="shape"></div>
+        <div class="shape"></div>
+        <div class="shape"></div>
+    </div>
+
+    <div class="geometric-grid"></div>
+
+    <div class="cube-container left">
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+    </div>
+
+    <div class="cube-container right">
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+        <div class="cube-face"></div>
+    </div>
+
+    <div class="torus one"></div>
+    <div class="torus two"></div>
+
+    <div class="particles" id="particles"></div>
+
+    <div class="scene">
+        <div class="glass-card" id="card">
+            <div class="card-glow"></div>
+            %s
+            <div class="brand">%s</div>
+            <h1 class="form-title">{{login.title}}</h1>
+            <p class="form-subtitle">{{login.subtitle}}</p>
+
+            %s
+
+            <form method="POST" action="%s">
+                <div class="input-group">
+                    <label>{{login.identifier}}</label>
+                    <input type="text" name="identifier" placeholder="you@example.com" autocomplete="username" required>
+                </div>
+
+                <div class="input-group">
+                    <label>{{field.password}}</label>
+                    <input type="password" name="password" placeholder="••••••••" required>
+                </div>
+
+                <button type="submit" class="submit-btn">{{login.submit}}</button>
+                <button type="submit" class="magic-link-btn" formaction="%s" formnovalidate>✉️ {{login.magic_link}}</button>
+            </form>
+
+            <p class="alt-action">{{login.no_account}} <a href="%s">{{login.create_account}}</a></p>
+
+            %s
+        </div>
+    </div>
+
+    <script src="%s" nonce="%s"></script>
+    <script nonce="%s">
+        const particlesContainer = document.getElementById('particles');
+        for (let i = 0; i < 30; i++) {
+            const particle = document.createElement('div');
+            particle.className = 'particle';
+            particle.style.left = Math.random() * 100 + '%%';
+            particle.style.animationDelay = Math.random() * 15 + 's';
+            particle.style.animationDuration = (10 + Math.random() * 10) + 's';
+            particlesContainer.appendChild(particle);
+        }
+
+        const card = document.getElementById('card');
+        document.addEventListener('mousemove', (e) => {
+            const xAxis = (window.innerWidth / 2 - e.pageX) / 25;
+            const yAxis = (window.innerHeight / 2 - e.pageY) / 25;
+            card.style.transform = 'rotateY(' + xAxis + 'deg) rotateX(' + yAxis + 'deg)';
+        });
+
+        document.addEventListener('mouseleave', () => {
+            card.style.transform = 'rotateX(5deg) rotateY(0deg)';
+        });
+    </script>
+</body>
+</html>`), html.EscapeString(a.theme.ProductName), a.asset("app.css"), a.themeStyle(c), nonce, a.renderLanguageSwitcher(c, a.path("/login")), a.renderBrand(), errorHTML, html.EscapeString(action), a.path("/login/magic"), a.path("/register"), demoHTML,
+		a.asset("forms.js"), nonce, nonce)
+}
+
+func (a *Auth) renderRegisterPage(c *fiber.Ctx, errorMsg, inviteCode, workspaceToken string) string {
+	l := a.localizer(c)
+	nonce := CSPNonce(c)
+	denyFraming(c)
+
+	errorHTML := ""
+	if errorMsg != "" {
+		errorHTML = fmt.Sprintf(`<div class="error-shake bg-red-500/20 border border-red-500/50 text-red-200 px-4 py-3 rounded-xl mb-6 backdrop-blur-sm">%s</div>`, errorMsg)
+	} else if a.cfg.RegistrationMode == registrationClosed {
+		errorHTML = `<div class="bg-amber-500/20 border border-amber-500/50 text-amber-200 px-4 py-3 rounded-xl mb-6 backdrop-blur-sm">` + html.EscapeString(l.T("register.closed")) + `</div>`
+	}
+
+	inviteHTML, emailAttrs := "", ""
+	if inv := a.orgInvitationByToken(workspaceToken); inv != nil {
+		// The link in a workspace invitation stands in for a code, for
+		// the address it was sent to.
+		inviteHTML = fmt.Sprintf(`<input type="hidden" name="workspace_invite" value="%s">`, html.EscapeString(workspaceToken))
+		emailAttrs = fmt.Sprintf(`value="%s" readonly`, html.EscapeString(inv.Email))
+	} else if a.cfg.RegistrationMode == registrationInviteOnly || inviteCode != "" {
+		required := ""
+		if a.cfg.RegistrationMode == registrationInviteOnly {
+			required = "required"
+		}
+		inviteHTML = fmt.Sprintf(l.Page(`<div class="input-group">
+                    <label>{{register.invite_code}}</label>
+                    <input type="text" name="invite_code" value="%s" placeholder="{{register.invite_code_placeholder}}" autocomplete="off" %s>
+                </div>`), html.EscapeString(inviteCode), required)
+	}
+
+	disabled := ""
+	if a.cfg.RegistrationMode == registrationClosed {
+		disabled = "disabled"
+	}
+
+	return fmt.Sprintf(l.Page(`<!DOCTYPE html>
+<html lang="{{lang}}" dir="{{dir}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{register.page_title}} | %s</title>
+    <link rel="stylesheet" href="%s">
+    %s
+    <style nonce="%s">
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        
+        body {
+            min-height: 100vh;
+            background: var(--background);
+            overflow: hidden;
+            font-family: var(--font);
+        }
+
+        .scene {
+            perspective: 1500px;
+            perspective-origin: 50%% 50%%;
+            position: fixed;
+            inset: 0;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+        }
+
+        .floating-shapes {
+            position: fixed;
+            inset: 0;
+            pointer-events: none;
+            overflow: hidden;
+        }
+
+        .shape {
+            position: absolute;
+            border-radius: 50%%;
+            background: linear-gradient(135deg, rgba(var(--highlight-rgb), 0.3), rgba(var(--secondary-rgb), 0.3));
+            filter: blur(1px);
+            animation: float 20s infinite ease-in-out;
+        }
+
+        .shape:nth-child(1) { width: 300px; height: 300px; top: -150px; left: 10%%; animation-delay: 0s; background: linear-gradient(135deg, rgba(var(--secondary-rgb), 0.3), rgba(var(--secondary-rgb), 0.3)); }
+        .shape:nth-child(2) { width: 200px; height: 200px; top: 60%%; right: -100px; animation-delay: -5s; background: linear-gradient(135deg, rgba(var(--highlight-rgb), 0.3), rgba(var(--highlight-rgb), 0.3)); }
+        .shape:nth-child(3) { width: 150px; height: 150px; bottom: -75px; left: 30%%; animation-delay: -10s; }
+        .shape:nth-child(4) { width: 250px; height: 250px; top: 20%%; right: 20%%; animation-delay: -15s; background: linear-gradient(135deg, rgba(var(--primary-rgb), 0.3), rgba(var(--primary-rgb), 0.3)); }
+        .shape:nth-child(5) { width: 180px; height: 180px; bottom: 20%%; left: -90px; animation-delay: -7s; background: linear-gradient(135deg, rgba(var(--accent-rgb), 0.3), rgba(var(--accent-rgb), 0.3)); }
+
+        @keyframes float {
+            0%%, 100%% { transform: translate(0, 0) rotate(0deg) scale(1); }
+            25%% { transform: translate(30px, -30px) rotate(90deg) scale(1.1); }
+            50%% { transform: translate(-20px, 20px) rotate(180deg) scale(0.9); }
+            75%% { transform: translate(40px, 10px) rotate(270deg) scale(1.05); }
+        }
+
+        .geometric-grid {
+            position: fixed;
+            inset: 0;
+            background-image: 
+                linear-gradient(rgba(var(--highlight-rgb), 0.03) 1px, transparent 1px),
+                linear-gradient(90deg, rgba(var(--highlight-rgb), 0.03) 1px, transparent 1px);
+            background-size: 50px 50px;
+            transform: perspective(500px) rotateX(60deg);
+            transform-origin: center top;
+            animation: gridMove 20s linear infinite;
+        }
+
+        @keyframes gridMove {
+            0%% { background-position: 0 0; }
+            100%% { background-position: 50px 50px; }
+        }
+
+        .pyramid {
+            position: fixed;
+            width: 0;
+            height: 0;
+            border-left: 60px solid transparent;
+            border-right: 60px solid transparent;
+            border-bottom: 100px solid rgba(var(--highlight-rgb), 0.15);
+            animation: rotatePyramid 15s linear infinite;
+        }
+
+        .pyramid.one { top: 15%%; left: 8%%; }
+        .pyramid.two { bottom: 15%%; right: 8%%; animation-direction: reverse; border-bottom-color: rgba(var(--secondary-rgb), 0.15); }
+
+        @keyframes rotatePyramid {
+            0%% { transform: rotateY(0deg); }
+            100%% { transform: rotateY(360deg); }
+        }
+
+        .glass-card {
+            width: 420px;
+            padding: 3rem;
+            background: rgba(var(--fg-rgb), 0.03);
+            backdrop-filter: blur(20px);
+            border-radius: 24px;
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            box-shadow: 
+                0 25px 50px -12px rgba(0, 0, 0, 0.5),
+                0 0 0 1px rgba(var(--fg-rgb), 0.05) inset,
+                0 -20px 40px -20px rgba(var(--highlight-rgb), 0.3) inset;
+            transform-style: preserve-3d;
+            transform: rotateX(5deg) rotateY(0deg);
+            transition: transform 0.1s ease-out;
+            animation: cardEntrance 1s ease-out;
+        }
+
+        @keyframes cardEntrance {
+            0%% { opacity: 0; transform: rotateX(-20deg) rotateY(20deg) translateZ(-100px); }
+            100%% { opacity: 1; transform: rotateX(5deg) rotateY(0deg) translateZ(0); }
+        }
+
+        .card-glow {
+            position: absolute;
+            inset: -2px;
+            background: linear-gradient(135deg, rgba(var(--highlight-rgb), 0.5), rgba(var(--secondary-rgb), 0.5), rgba(var(--secondary-rgb), 0.5));
+            border-radius: 26px;
+            z-index: -1;
+            filter: blur(20px);
+            opacity: 0.5;
+            animation: glowPulse 3s ease-in-out infinite;
+        }
+
+        @keyframes glowPulse {
+            0%%, 100%% { opacity: 0.3; transform: scale(1); }
+            50%% { opacity: 0.6; transform: scale(1.02); }
+        }
+
+        .form-title {
+            font-size: 2rem;
+            font-weight: 700;
+            text-align: center;
+            margin-bottom: 0.5rem;
+            background: linear-gradient(135deg, var(--heading) 0%%, var(--highlight-light) 50%%, var(--secondary-light) 100%%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+            background-clip: text;
+            text-shadow: 0 0 40px rgba(var(--highlight-rgb), 0.5);
+        }
+
+        .form-subtitle {
+            text-align: center;
+            color: rgba(var(--fg-rgb), 0.5);
+            margin-bottom: 2rem;
+            font-size: 0.9rem;
+        }
+
+        .input-group {
+            position: relative;
+            margin-bottom: 1.25rem;
+        }
+
+        .input-group label {
+            display: block;
+            color: rgba(var(--fg-rgb), 0.7);
+            font-size: 0.85rem;
+            margin-bottom: 0.5rem;
+            font-weight: 500;
+        }
+
+        .input-group input {
+            width: 100%%;
+            padding: 1rem 1.25rem;
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 12px;
+            color: var(--fg);
+            font-size: 1rem;
+            transition: all 0.3s ease;
+            outline: none;
+        }
+
+        .input-group input:focus {
+            border-color: rgba(var(--highlight-rgb), 0.5);
+            background: rgba(var(--fg-rgb), 0.08);
+            box-shadow: 0 0 20px rgba(var(--highlight-rgb), 0.2);
+        }
+
+        .input-group input::placeholder {
+            color: rgba(var(--fg-rgb), 0.3);
+        }
+
+        .strength-meter {
+            height: 4px;
+            margin-top: 0.5rem;
+            background: rgba(var(--fg-rgb), 0.08);
+            border-radius: 2px;
+            overflow: hidden;
+        }
+
+        .strength-bar {
+            width: 0;
+            height: 100%%;
+            transition: width 0.3s ease, background 0.3s ease;
+        }
+
+        .strength-reasons {
+            margin-top: 0.5rem;
+            list-style: none;
+            color: var(--danger);
+            font-size: 0.8rem;
+        }
+
+        .submit-btn {
+            width: 100%%;
+            padding: 1rem;
+            background: linear-gradient(135deg, var(--highlight) 0%%, var(--highlight-blend) 50%%, var(--secondary) 100%%);
+            border: none;
+            border-radius: 12px;
+            color: white;
+            font-size: 1rem;
+            font-weight: 600;
+            cursor: pointer;
+            transition: all 0.3s ease;
+            position: relative;
+            overflow: hidden;
+            margin-top: 0.5rem;
+        }
+
+        .submit-btn::before {
+            content: '';
+            position: absolute;
+            inset: 0;
+            background: linear-gradient(135deg, transparent, rgba(255, 255, 255, 0.2), transparent);
+            transform: translateX(-100%%);
+            transition: transform 0.5s ease;
+        }
+
+        .submit-btn:hover {
+            transform: translateY(-2px);
+            box-shadow: 0 10px 30px rgba(var(--highlight-rgb), 0.4);
+        }
+
+        .submit-btn:hover::before {
+            transform: translateX(100%%);
+        }
+
+        .submit-btn:active {
+            transform: translateY(0);
+        }
+
+        .alt-action {
+            text-align: center;
+            margin-top: 1.5rem;
+            color: rgba(var(--fg-rgb), 0.5);
+            font-size: 0.9rem;
+        }
+
+        .alt-action a {
+            color: var(--highlight-light);
+            text-decoration: none;
+            font-weight: 500;
+            transition: color 0.3s ease;
+        }
+
+        .alt-action a:hover {
+            color: var(--highlight-lighter);
+            text-decoration: underline;
+        }
+
+        .particles {
+            position: fixed;
+            inset: 0;
+            pointer-events: none;
+        }
+
+        .particle {
+            position: absolute;
+            width: 4px;
+            height: 4px;
+            background: rgba(var(--highlight-rgb), 0.6);
+            border-radius: 50%%;
+            animation: particleFloat 15s infinite linear;
+        }
+
+        @keyframes particleFloat {
+            0%% { transform: translateY(100vh) rotate(0deg); opacity: 0; }
+            10%% { opacity: 1; }
+            90%% { opacity: 1; }
+            100%% { transform: translateY(-100vh) rotate(720deg); opacity: 0; }
+        }
+
+        .error-shake {
+            animation: shake 0.5s ease-in-out;
+        }
+
+        @keyframes shake {
+            0%%, 100%% { transform: translateX(0); }
+            20%% { transform: translateX(-10px); }
+            40%% { transform: translateX(10px); }
+            60%% { transform: translateX(-10px); }
+            80%% { transform: translateX(10px); }
+        }
+
+        .hex-ring {
+            position: fixed;
+            width: 150px;
+            height: 150px;
+            border: 3px solid rgba(var(--highlight-rgb), 0.2);
+            clip-path: polygon(50%% 0%%, 100%% 25%%, 100%% 75%%, 50%% 100%%, 0%% 75%%, 0%% 25%%);
+            animation: spinHex 20s linear infinite;
+        }
+
+        .hex-ring.one { top: 10%%; right: 15%%; }
+        .hex-ring.two { bottom: 10%%; left: 15%%; animation-direction: reverse; border-color: rgba(var(--secondary-rgb), 0.2); }
+
+        @keyframes spinHex {
+            0%% { transform: rotate(0deg); }
+            100%% { transform: rotate(360deg); }
+        }
+
+        .brand {
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            gap: 0.5rem;
+            margin-bottom: 1rem;
+            color: rgba(var(--fg-rgb), 0.6);
+            font-size: 0.85rem;
+            font-weight: 600;
+            letter-spacing: 0.05em;
+        }
+
+        .brand-logo { height: 28px; width: auto; }
+
+        .language-switcher {
+            position: absolute;
+            top: 1rem;
+            inset-inline-end: 1rem;
+        }
+
+        .language-switcher select {
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 8px;
+            color: rgba(var(--fg-rgb), 0.7);
+            font-size: 0.75rem;
+            padding: 0.25rem 0.5rem;
+            cursor: pointer;
+        }
+
+        .language-switcher option { color: var(--fg); background: var(--surface); }
+
+        /* Mirror the scene for right-to-left languages. */
+        [dir="rtl"] .shape:nth-child(1) { left: auto; right: 10%%; }
+        [dir="rtl"] .shape:nth-child(2) { right: auto; left: -100px; }
+        [dir="rtl"] .shape:nth-child(3) { left: auto; right: 30%%; }
+        [dir="rtl"] .shape:nth-child(4) { right: auto; left: 20%%; }
+        [dir="rtl"] .shape:nth-child(5) { left: auto; right: -90px; }
+        [dir="rtl"] .pyramid.one { left: auto; right: 8%%; }
+        [dir="rtl"] .pyramid.two { right: auto; left: 8%%; }
+        [dir="rtl"] .hex-ring.one { right: auto; left: 15%%; }
+        [dir="rtl"] .hex-ring.two { left: auto; right: 15%%; }
+        [dir="rtl"] .glass-card { animation-name: cardEntranceRtl; }
+        [dir="rtl"] .submit-btn::before { transform: translateX(100%%); }
+        [dir="rtl"] .submit-btn:hover::before { transform: translateX(-100%%); }
+
+        @keyframes cardEntranceRtl {
+            0%% { opacity: 0; transform: rotateX(-20deg) rotateY(-20deg) translateZ(-100px); }
+            100%% { opacity: 1; transform: rotateX(5deg) rotateY(0deg) translateZ(0); }
+        }
+    </style>
+</head>
+<body>
+    <div class="floating-shapes">
+        <div class="shape"></div>
+        <div class="shape"></div>
+        <div class="shape"></div>
+        <div class="shape"></div>
+        <div class="shape"></div>
+    </div>
+
+    <div class="geometric-grid"></div>
+
+    <div class="pyramid one"></div>
+    <div class="pyramid two"></div>
+
+    <div class="hex-ring one"></div>
+    <div class="hex-ring two"></div>
+
+    <div class="particles" id="particles"></div>
+
+    <div class="scene">
+        <div class="glass-card" id="card">
+            <div class="card-glow"></div>
+            %s
+            <div class="brand">%s</div>
+            <h1 class="form-title">{{register.title}}</h1>
+            <p class="form-subtitle">{{register.subtitle}}</p>
+
+            %s
+
+            <form method="POST" action="%s">
+                %s
+
+                <div class="input-group">
+                    <label>{{field.email}}</label>
+                    <input type="email" name="email" id="email" placeholder="you@example.com" required %s>
+                </div>
+
+                <div class="input-group">
+                    <label>{{field.password}}</label>
+                    <input type="password" name="password" id="password" placeholder="••••••••" required minlength="%d" maxlength="%d">
+                    <div class="strength-meter"><div class="strength-bar" id="strength-bar"></div></div>
+                    <ul class="strength-reasons" id="strength-reasons"></ul>
+                </div>
+
+                <div class="input-group">
+                    <label>{{field.confirm_password}}</label>
+                    <input type="password" name="confirm_password" placeholder="••••••••" required minlength="%d" maxlength="%d">
+                </div>
+
+                <button type="submit" class="submit-btn" %s>{{register.submit}}</button>
+            </form>
+
+            <p class="alt-action">{{register.have_account}} <a href="%s">{{register.sign_in}}</a></p>
+        </div>
+    </div>
+
+    <script src="%s" nonce="%s"></script>
+    <script nonce="%s">
+        const particlesContainer = document.getElementById('particles');
+        for (let i = 0; i < 30; i++) {
+            const particle = document.createElement('div');
+            particle.className = 'particle';
+            particle.style.left = Math.random() * 100 + '%%';
+            particle.style.animationDelay = Math.random() * 15 + 's';
+            particle.style.animationDuration = (10 + Math.random() * 10) + 's';
+            particlesContainer.appendChild(particle);
+        }
+
+        const card = document.getElementById('card');
+        document.addEventListener('mousemove', (e) => {
+            const xAxis = (window.innerWidth / 2 - e.pageX) / 25;
+            const yAxis = (window.innerHeight / 2 - e.pageY) / 25;
+            card.style.transform = 'rotateY(' + xAxis + 'deg) rotateX(' + yAxis + 'deg)';
+        });
+
+        document.addEventListener('mouseleave', () => {
+            card.style.transform = 'rotateX(5deg) rotateY(0deg)';
+        });
+
+        // Mirrors PasswordPolicy.check and PasswordPolicy.Score in policy.go.
+        const passwordInput = document.getElementById('password');
+        const emailInput = document.getElementById('email');
+        const strengthBar = document.getElementById('strength-bar');
+        const strengthReasons = document.getElementById('strength-reasons');
+        const strengthColors = ['#ef4444', '#f97316', '#eab308', '#22c55e', '#10b981'];
+        let policy = null;
+
+        function matchToken(chars, i, tokens) {
+            let longest = 0;
+            for (const t of tokens) {
+                const tc = Array.from(t);
+                if (tc.length > longest && i + tc.length <= chars.length && chars.slice(i, i + tc.length).join('') === t) {
+                    longest = tc.length;
+                }
+            }
+            return longest;
+        }
+
+        function entropyBits(pw, email) {
+            const tokens = policy.common_words.concat(policy.blocked_terms || []);
+            const local = email.toLowerCase().split('@')[0];
+            if (Array.from(local).length >= 3) tokens.push(local);
+
+            let lower = false, upper = false, digit = false, symbol = false;
+            for (const ch of pw) {
+                if (/\p{Ll}/u.test(ch)) lower = true;
+                else if (/\p{Lu}/u.test(ch)) upper = true;
+                else if (/\p{Nd}/u.test(ch)) digit = true;
+                else symbol = true;
+            }
+            const pool = (lower ? 26 : 0) + (upper ? 26 : 0) + (digit ? 10 : 0) + (symbol ? 33 : 0);
+            if (pool === 0) return 0;
+            const charBits = Math.log2(pool);
+
+            const chars = Array.from(pw.toLowerCase());
+            let bits = 0;
+            for (let i = 0; i < chars.length;) {
+                const n = matchToken(chars, i, tokens);
+                if (n > 0) {
+                    bits += Math.log2(tokens.length);
+                    i += n;
+                    continue;
+                }
+                const diff = i > 0 ? chars[i].codePointAt(0) - chars[i - 1].codePointAt(0) : 2;
+                bits += (diff >= -1 && diff <= 1) ? 1 : charBits;
+                i++;
+            }
+            return bits;
+        }
+
+        function score(pw, email) {
+            const bits = entropyBits(pw, email);
+            if (bits < 10) return 0;
+            if (bits < 20) return 1;
+            if (bits < 27) return 2;
+            if (bits < 34) return 3;
+            return 4;
+        }
+
+        function check(pw, email) {
+            const reasons = [];
+            const length = Array.from(pw).length;
+            if (length < policy.min_length) reasons.push('%s');
+            if (length > policy.max_length) reasons.push('%s');
+            else if (policy.max_bytes && new TextEncoder().encode(pw).length > policy.max_bytes) reasons.push('%s');
+
+            const lowerPw = pw.toLowerCase();
+            const lowerEmail = email.toLowerCase();
+            const local = lowerEmail.split('@')[0];
+            if (lowerEmail !== '' && (lowerPw.includes(lowerEmail) || (Array.from(local).length >= 3 && lowerPw.includes(local)))) {
+                reasons.push('{{js:policy.contains_email}}');
+            }
+            for (const term of policy.blocked_terms || []) {
+                if (lowerPw.includes(term)) reasons.push('{{js:policy.contains_term}}'.replace('%%q', '"' + term + '"'));
+            }
+
+            const s = score(pw, email);
+            if (s < policy.min_score) reasons.push('{{js:policy.too_weak}}'.replace('%%d', s).replace('%%d', policy.min_score));
+            return { score: s, reasons: reasons };
+        }
+
+        function updateStrength() {
+            if (!policy) return;
+            const pw = passwordInput.value;
+            strengthReasons.textContent = '';
+            if (pw === '') {
+                strengthBar.style.width = '0';
+                return;
+            }
+            const result = check(pw, emailInput.value);
+            strengthBar.style.width = ((result.score + 1) * 20) + '%%';
+            strengthBar.style.background = strengthColors[result.score];
+            for (const reason of result.reasons) {
+                const li = document.createElement('li');
+                li.textContent = reason;
+                strengthReasons.appendChild(li);
+            }
+        }
+
+        passwordInput.addEventListener('input', updateStrength);
+        emailInput.addEventListener('input', updateStrength);
+        fetch('%s').then((r) => r.json()).then((p) => { policy = p; updateStrength(); });
+    </script>
+</body>
+</html>`), html.EscapeString(a.theme.ProductName), a.asset("app.css"), a.themeStyle(c), nonce, a.renderLanguageSwitcher(c, a.path("/register")), a.renderBrand(), errorHTML, a.path("/register"), inviteHTML, emailAttrs,
+		a.cfg.PasswordPolicy.MinLength, a.cfg.PasswordPolicy.MaxLength, a.cfg.PasswordPolicy.MinLength, a.cfg.PasswordPolicy.MaxLength, disabled, a.path("/login"), a.asset("forms.js"), nonce, nonce,
+		jsString(l.N("policy.min_length", a.cfg.PasswordPolicy.MinLength)), jsString(l.N("policy.max_length", a.cfg.PasswordPolicy.MaxLength)),
+		jsString(l.N("policy.max_bytes", a.cfg.PasswordPolicy.MaxBytes)), a.path("/password-policy"))
+}
+
+func (a *Auth) renderDashboard(c *fiber.Ctx, errorMsg, noticeMsg string) string {
+	user := CurrentUser(c)
+	membership := CurrentMembership(c)
+	l := a.localizer(c)
+	nonce := CSPNonce(c)
+
+	errorHTML := ""
+	if errorMsg != "" {
+		errorHTML = fmt.Sprintf(`<div class="error-shake bg-red-500/20 border border-red-500/50 text-red-200 px-4 py-3 rounded-xl mb-6 backdrop-blur-sm">%s</div>`, errorMsg)
+	} else if noticeMsg != "" {
+		errorHTML = fmt.Sprintf(`<div class="bg-emerald-500/20 border border-emerald-500/50 text-emerald-200 px-4 py-3 rounded-xl mb-6 backdrop-blur-sm">%s</div>`, noticeMsg)
+	}
+
+	deletionHTML := fmt.Sprintf(l.Page(`<form method="POST" action="%s" class="account-row" data-confirm="{{account.delete_confirm}}">
+                <input type="password" name="password" placeholder="{{account.delete_password}}" required>
+                <button type="submit" class="danger-btn">{{account.delete}}</button>
+            </form>`), a.path("/account/delete"))
+	if user.DeleteAfter != nil {
+		deletionHTML = fmt.Sprintf(l.Page(`<div class="deletion-banner">%s</div>
+            <form method="POST" action="%s" class="account-row">
+                <button type="submit" class="account-btn">{{account.cancel_deletion}}</button>
+            </form>`), fmt.Sprintf(l.H("account.deletion_scheduled"),
+			"<strong>"+html.EscapeString(l.Date(*user.DeleteAfter))+"</strong>", user.DeleteAfter.Format("15:04 MST")), a.path("/account/delete/cancel"))
+	}
+
+	phone := user.Phone
+	if user.PhoneE164 != nil {
+		phone = a.formatPhone(user.Phone)
+	}
+
+	var schemeOptions strings.Builder
+	for _, scheme := range []string{"", schemeLight, schemeDark} {
+		selected := ""
+		if scheme == user.ColorScheme {
+			selected = " selected"
+		}
+		key := "account.scheme_default"
+		if scheme != "" {
+			key = "account.scheme_" + scheme
+		}
+		fmt.Fprintf(&schemeOptions, `<option value="%s"%s>%s</option>`, scheme, selected, l.H(key))
+	}
+
+	passwordNoticeHTML := ""
+	if user.PasswordChangeRequired {
+		passwordNoticeHTML = `<div class="deletion-banner">` + l.H("account.password_breached") + `</div>`
+	}
+
+	return fmt.Sprintf(l.Page(`<!DOCTYPE html>
+<html lang="{{lang}}" dir="{{dir}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{dashboard.page_title}} | %s</title>
+    <link rel="stylesheet" href="%s">
+    %s
+    <style nonce="%s">
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        
+        body {
+            min-height: 100vh;
+            background: var(--background);
+            font-family: var(--font);
+        }
+
+        .navbar {
+            position: fixed;
+            top: 0;
+            left: 0;
+            right: 0;
+            height: 70px;
+            background: rgba(var(--fg-rgb), 0.03);
+            backdrop-filter: blur(20px);
+            border-bottom: 1px solid rgba(var(--fg-rgb), 0.1);
+            display: flex;
+            align-items: center;
+            justify-content: space-between;
+            padding: 0 2rem;
+            z-index: 100;
+        }
+
+        .logo {
+            font-size: 1.5rem;
+            font-weight: 700;
+            background: linear-gradient(135deg, var(--heading) 0%%, var(--primary-light) 50%%, var(--secondary-light) 100%%);
+            -webkit-background-clip: text;
+            -webkit-text-fill-color: transparent;
+            background-clip: text;
+        }
+
+        .logo .brand-logo {
+            display: inline-block;
+            height: 32px;
+            width: auto;
+            vertical-align: middle;
+            margin-inline-end: 0.5rem;
+        }
+
+        .workspace-switcher select {
+            padding: 0.5rem 1rem;
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 10px;
+            color: var(--fg);
+            font-size: 0.9rem;
+            outline: none;
+            cursor: pointer;
+        }
+
+        .workspace-switcher option {
+            background: var(--surface);
+        }
+
+        .language-switcher { margin: 0; }
+
+        .language-switcher select {
+            padding: 0.5rem 0.75rem;
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 10px;
+            color: rgba(var(--fg-rgb), 0.7);
+            font-size: 0.85rem;
+            outline: none;
+            cursor: pointer;
+        }
+
+        .language-switcher option {
+            background: var(--surface);
+        }
+
+        .user-section {
+            display: flex;
+            align-items: center;
+            gap: 1.5rem;
+        }
+
+        .user-email {
+            color: rgba(var(--fg-rgb), 0.7);
+            font-size: 0.9rem;
+        }
+
+        .logout-btn {
+            padding: 0.6rem 1.5rem;
+            background: rgba(239, 68, 68, 0.2);
+            border: 1px solid rgba(239, 68, 68, 0.3);
+            border-radius: 10px;
+            color: var(--danger);
+            font-size: 0.9rem;
+            font-weight: 500;
+            cursor: pointer;
+            transition: all 0.3s ease;
+        }
+
+        .logout-btn:hover {
+            background: rgba(239, 68, 68, 0.3);
+            border-color: rgba(239, 68, 68, 0.5);
+            transform: translateY(-2px);
+            box-shadow: 0 5px 20px rgba(239, 68, 68, 0.2);
+        }
+
+        .dashboard-content {
+            display: flex;
+            flex-direction: column;
+            align-items: center;
+            justify-content: center;
+            gap: 3rem;
+            min-height: 100vh;
+            padding: 70px 1rem 2rem;
+        }
+
+        .empty-state {
+            text-align: center;
+            color: rgba(var(--fg-rgb), 0.4);
+        }
+
+        .empty-icon {
+            width: 120px;
+            height: 120px;
+            margin: 0 auto 1.5rem;
+            background: rgba(var(--fg-rgb), 0.03);
+            border-radius: 50%%;
+            display: flex;
+            align-items: center;
+            justify-content: center;
+            border: 2px dashed rgba(var(--fg-rgb), 0.1);
+        }
+
+        .empty-icon svg {
+            width: 50px;
+            height: 50px;
+            stroke: rgba(var(--fg-rgb), 0.2);
+        }
+
+        .empty-title {
+            font-size: 1.5rem;
+            margin-bottom: 0.5rem;
+            color: rgba(var(--fg-rgb), 0.6);
+        }
+
+        .empty-text {
+            font-size: 1rem;
+        }
+
+        .floating-orbs {
+            position: fixed;
+            inset: 0;
+            pointer-events: none;
+            overflow: hidden;
+        }
+
+        .orb {
+            position: absolute;
+            border-radius: 50%%;
+            filter: blur(60px);
+            opacity: 0.3;
+            animation: orbFloat 30s infinite ease-in-out;
+        }
+
+        .orb:nth-child(1) { width: 400px; height: 400px; background: var(--primary); top: -200px; left: -200px; }
+        .orb:nth-child(2) { width: 300px; height: 300px; background: var(--secondary); bottom: -150px; right: -150px; animation-delay: -10s; }
+        .orb:nth-child(3) { width: 350px; height: 350px; background: var(--accent); top: 50%%; right: -175px; animation-delay: -20s; }
+
+        @keyframes orbFloat {
+            0%%, 100%% { transform: translate(0, 0); }
+            50%% { transform: translate(50px, 50px); }
+        }
+
+        .account-panel {
+            width: 100%%;
+            max-width: 480px;
+            padding: 2rem;
+            background: rgba(var(--fg-rgb), 0.03);
+            backdrop-filter: blur(20px);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 20px;
+            color: rgba(var(--fg-rgb), 0.7);
+        }
+
+        .account-panel h3 {
+            font-size: 1.1rem;
+            font-weight: 600;
+            color: rgba(var(--fg-rgb), 0.8);
+            margin-bottom: 1rem;
+        }
+
+        .account-row {
+            display: flex;
+            gap: 0.75rem;
+            margin-top: 1rem;
+        }
+
+        .account-panel select {
+            padding: 0.6rem 1rem;
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 10px;
+            color: var(--fg);
+        }
+
+        .account-panel code {
+            color: var(--primary-lighter);
+            word-break: break-all;
+        }
+
+        .account-table {
+            width: 100%%;
+            margin-top: 1rem;
+            font-size: 0.85rem;
+            border-collapse: collapse;
+        }
+
+        .account-table th, .account-table td {
+            padding: 0.5rem 0.25rem;
+            text-align: start;
+            border-bottom: 1px solid rgba(var(--fg-rgb), 0.06);
+        }
+
+        .account-table th {
+            color: rgba(var(--fg-rgb), 0.5);
+            font-weight: 500;
+        }
+
+        .section-gap {
+            margin-top: 1.5rem;
+        }
+
+        .bare-form { margin: 0; }
+
+        .inline-form { display: inline; }
+
+        .account-row.centered { align-items: center; }
+
+        .account-row .grow { flex: 1; }
+
+        .account-row.flush { margin-top: 0; }
+
+        .account-stack {
+            display: flex;
+            flex-direction: column;
+            gap: 0.75rem;
+        }
+
+        .account-stack button {
+            align-self: flex-start;
+        }
+
+        .account-row input, .account-stack input {
+            flex: 1;
+            padding: 0.6rem 1rem;
+            background: rgba(var(--fg-rgb), 0.05);
+            border: 1px solid rgba(var(--fg-rgb), 0.1);
+            border-radius: 10px;
+            color: var(--fg);
+            outline: none;
+        }
+
+        .account-btn, .danger-btn {
+            display: inline-block;
+            padding: 0.6rem 1.25rem;
+            border-radius: 10px;
+            font-size: 0.9rem;
+            font-weight: 500;
+            cursor: pointer;
+            text-decoration: none;
+            transition: all 0.3s ease;
+        }
+
+        .account-btn {
+            background: rgba(var(--primary-rgb), 0.2);
+            border: 1px solid rgba(var(--primary-rgb), 0.3);
+            color: var(--primary-lighter);
+        }
+
+        .danger-btn {
+            background: rgba(239, 68, 68, 0.2);
+            border: 1px solid rgba(239, 68, 68, 0.3);
+            color: var(--danger);
+        }
+
+        .account-btn:hover, .danger-btn:hover {
+            transform: translateY(-2px);
+        }
+
+        .deletion-banner {
+            margin-bottom: 1rem;
+            padding: 0.75rem 1rem;
+            background: rgba(239, 68, 68, 0.15);
+            border: 1px solid rgba(239, 68, 68, 0.3);
+            border-radius: 10px;
+            color: var(--danger);
+            font-size: 0.9rem;
+        }
+    </style>
+</head>
+<body>
+    <div class="floating-orbs">
+        <div class="orb"></div>
+        <div class="orb"></div>
+        <div class="orb"></div>
+    </div>
+
+    <nav class="navbar">
+        <div class="logo">%s</div>
+        %s
+        <div class="user-section">
+            %s
+            <span class="user-email">%s</span>
+            <form method="POST" action="%s" class="bare-form">
+                <button type="submit" class="logout-btn">{{dashboard.sign_out}}</button>
+            </form>
+        </div>
+    </nav>
+
+    <main class="dashboard-content">
+        <div class="empty-state">
+            <div class="empty-icon">
+                <svg fill="none" viewBox="0 0 24 24" stroke="currentColor">
+                    <path stroke-linecap="round" stroke-linejoin="round" stroke-width="1.5" d="M20 7l-8-4-8 4m16 0l-8 4m8-4v10l-8 4m0-10L4 7m8 4v10M4 7v10l8 4" />
+                </svg>
+            </div>
+            <h2 class="empty-title">%s</h2>
+            <p class="empty-text">{{dashboard.empty}}</p>
+        </div>
+
+        %s
+
+        %s
+
+        %s
+
+        <section class="account-panel">
+            %s
+            <h3>{{account.phone}}</h3>
+            <form method="POST" action="%s" class="account-row">
+                <input type="tel" name="phone" value="%s" placeholder="+1 555 123 4567" autocomplete="tel">
+                <button type="submit" class="account-btn">{{account.save}}</button>
+            </form>
+
+            <h3 class="section-gap">{{account.appearance}}</h3>
+            <form method="POST" action="%s" class="account-row">
+                <select name="scheme" aria-label="{{account.appearance}}">%s</select>
+                <button type="submit" class="account-btn">{{account.save}}</button>
+            </form>
+
+            <h3 class="section-gap">{{account.change_password}}</h3>
+            %s
+            <form method="POST" action="%s" class="account-stack">
+                <input type="password" name="current_password" placeholder="{{account.current_password}}" required>
+                <input type="password" name="password" placeholder="{{account.new_password}}" required minlength="%d" maxlength="%d">
+                <input type="password" name="confirm_password" placeholder="{{account.confirm_new_password}}" required minlength="%d" maxlength="%d">
+                <button type="submit" class="account-btn">{{account.update_password}}</button>
+            </form>
+        </section>
+
+        %s
+
+        %s
+
+        <section class="account-panel">
+            <h3>{{account.your_data}}</h3>
+            <a href="%s" class="account-btn">{{account.download_data}}</a>
+            %s
+        </section>
+    </main>
+
+    <script src="%s" nonce="%s"></script>
+</body>
+</html>`), html.EscapeString(a.theme.ProductName), a.asset("app.css"), a.themeStyle(c), nonce, a.renderBrand(), a.renderWorkspaceSwitcher(l, user, membership), a.renderLanguageSwitcher(c, a.path("/dashboard")), html.EscapeString(user.Email), a.path("/logout"),
+		l.H("dashboard.welcome", membership.Organization.Name), a.renderOrgInvitationsPanel(l, user), a.renderWorkspacePanel(l, membership), a.renderMembersPanel(l, membership), errorHTML, a.path("/account/phone"), html.EscapeString(phone),
+		a.path("/account/appearance"), schemeOptions.String(), passwordNoticeHTML,
+		a.path("/account/password"), a.cfg.PasswordPolicy.MinLength, a.cfg.PasswordPolicy.MaxLength, a.cfg.PasswordPolicy.MinLength, a.cfg.PasswordPolicy.MaxLength,
+		a.renderInvitationsPanel(l, user), a.renderWebhooksPanel(l, user), a.path("/account/export"), deletionHTML, a.asset("forms.js"), nonce)
+}
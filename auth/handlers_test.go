@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPasswordLogin(t *testing.T) {
+	e := newTestEnv(t)
+	e.createUser(t, "user@example.com", testPassword, true)
+
+	if e.client(t).login("user@example.com", "not-the-password") {
+		t.Error("a wrong password signs in")
+	}
+	if e.client(t).login("nobody@example.com", testPassword) {
+		t.Error("an unknown address signs in")
+	}
+	c := e.client(t)
+	if !c.login(" USER@example.com ", testPassword) {
+		t.Fatal("the address is not matched regardless of case and spacing")
+	}
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("dashboard: status %d", resp.StatusCode)
+	}
+
+	c.post("/logout", url.Values{})
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusFound {
+		t.Errorf("dashboard after signing out: status %d, want a redirect", resp.StatusCode)
+	}
+}
+
+func TestLoginRespondsAlikeForUnknownAccountsAndWrongPasswords(t *testing.T) {
+	e := newTestEnv(t)
+	e.createUser(t, "user@example.com", testPassword, true)
+
+	unknownClient, wrongClient := e.client(t), e.client(t)
+	unknownResp, unknownBody := unknownClient.post("/login", url.Values{"identifier": {"nobody@example.com"}, "password": {"not-the-password"}})
+	wrongResp, wrongBody := wrongClient.post("/login", url.Values{"identifier": {"user@example.com"}, "password": {"not-the-password"}})
+
+	if unknownResp.StatusCode != wrongResp.StatusCode {
+		t.Errorf("status: unknown %d, wrong password %d", unknownResp.StatusCode, wrongResp.StatusCode)
+	}
+	for _, h := range []string{fiber.HeaderContentType, fiber.HeaderLocation, fiber.HeaderXFrameOptions} {
+		if unknownResp.Header.Get(h) != wrongResp.Header.Get(h) {
+			t.Errorf("%s: unknown %q, wrong password %q", h, unknownResp.Header.Get(h), wrongResp.Header.Get(h))
+		}
+	}
+	if u, w := cookieNames(unknownClient), cookieNames(wrongClient); !slices.Equal(u, w) {
+		t.Errorf("cookies: unknown %v, wrong password %v", u, w)
+	}
+	if sameShape(unknownBody, "nobody@example.com") != sameShape(wrongBody, "user@example.com") {
+		t.Error("response bodies differ between an unknown account and a wrong password")
+	}
+}
+
+func TestLoginDoesTheSameWorkForUnknownAccountsAndWrongPasswords(t *testing.T) {
+	e := newTestEnv(t)
+	e.createUser(t, "user@example.com", testPassword, true)
+	c := e.client(t)
+
+	attempt := func(identifier string) map[string]uint64 {
+		t.Helper()
+		verified, hashed := e.passwordHashes(t, "verify"), e.passwordHashes(t, "hash")
+		c.post("/login", url.Values{"identifier": {identifier}, "password": {"not-the-password"}})
+		if !maps.Equal(e.passwordHashes(t, "hash"), hashed) {
+			t.Errorf("%s: a password was hashed", identifier)
+		}
+		delta := e.passwordHashes(t, "verify")
+		for alg, n := range verified {
+			delta[alg] -= n
+			if delta[alg] == 0 {
+				delete(delta, alg)
+			}
+		}
+		return delta
+	}
+	unknown, wrong := attempt("nobody@example.com"), attempt("user@example.com")
+	if want := map[string]uint64{"argon2id": 1}; !maps.Equal(unknown, want) || !maps.Equal(wrong, want) {
+		t.Errorf("verifications: unknown account %v, wrong password %v; want %v for both", unknown, wrong, want)
+	}
+}
+
+func TestLoginTakesAsLongForUnknownAccountsAndWrongPasswords(t *testing.T) {
+	requireTimingTests(t)
+	e := newTestEnv(t)
+	e.createUser(t, "user@example.com", testPassword, true)
+
+	const rounds = 9
+	var unknown, wrong []time.Duration
+	c := e.client(t)
+	for i := range rounds {
+		start := time.Now()
+		c.post("/login", url.Values{"identifier": {fmt.Sprintf("nobody%d@example.com", i)}, "password": {"not-the-password"}})
+		unknown = append(unknown, time.Since(start))
+
+		start = time.Now()
+		c.post("/login", url.Values{"identifier": {"user@example.com"}, "password": {"not-the-password"}})
+		wrong = append(wrong, time.Since(start))
+	}
+	slices.Sort(unknown)
+	slices.Sort(wrong)
+	u, w := unknown[rounds/2], wrong[rounds/2]
+	if ratio := float64(u) / float64(w); ratio < 0.5 || ratio > 2 {
+		t.Errorf("median response time: unknown %v, wrong password %v", u, w)
+	}
+}
+
+func TestFailedLoginEventsAreRecordedOffTheRequestPath(t *testing.T) {
+	e := newTestEnv(t)
+	e.createUser(t, "user@example.com", testPassword, true)
+	// Keep the workers from starting so queued events stay queued.
+	e.auth.eventWorkers.Do(func() {})
+
+	c := e.client(t)
+	c.login("user@example.com", "not-the-password")
+	var recorded int64
+	e.auth.db.Model(&AuthEvent{}).Where("type = ?", eventLoginFailed).Count(&recorded)
+	if recorded != 0 || len(e.auth.eventQueue) != 1 {
+		t.Fatalf("%d events recorded and %d queued, want the event queued", recorded, len(e.auth.eventQueue))
+	}
+
+	for len(e.auth.eventQueue) < cap(e.auth.eventQueue) {
+		e.auth.eventQueue <- queuedAuthEvent{}
+	}
+	if c.login("user@example.com", "not-the-password") {
+		t.Fatal("a wrong password signs in")
+	}
+	if n := testutil.ToFloat64(e.auth.metrics.droppedAuthEventsTotal.WithLabelValues(eventLoginFailed)); n != 1 {
+		t.Errorf("dropped events = %v, want 1 once the queue is full", n)
+	}
+}
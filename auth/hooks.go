@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Actions reported to hooks.
+const (
+	ActionRegister       = "register"
+	ActionLogin          = "login"
+	ActionLogout         = "logout"
+	ActionPasswordChange = "password_change"
+	ActionDelete         = "delete"
+)
+
+// HookEvent describes an account change.
+type HookEvent struct {
+	Action string
+	// User is the account concerned. When a registration is submitted it
+	// is nil; when it is confirmed from the emailed link, Before gets the
+	// account about to be created, which has no ID yet.
+	User *User
+	// Email is the address being registered, or User's email.
+	Email string
+	// Method is how a login is made: "password" or "magic_link".
+	Method string
+	// IP is the client's address. It is empty when an account is purged
+	// after its deletion grace period.
+	IP string
+}
+
+// Hook runs application logic around account changes, such as
+// provisioning resources on sign-up or denying logins for billing reasons.
+type Hook interface {
+	// Before runs before the change is made. Returning an error cancels
+	// it and the error's message is shown to the user, so it should be
+	// safe to display. Registrations are checked twice: when submitted
+	// and again when confirmed, right before the account is created.
+	// Logouts cannot be cancelled; their errors are only logged.
+	Before(ctx context.Context, e HookEvent) error
+	// After runs once the change has been made. For registrations, User
+	// is the created account.
+	After(ctx context.Context, e HookEvent)
+}
+
+// newHookEvent returns an event for action by user made through c.
+func newHookEvent(c *fiber.Ctx, action string, user *User) HookEvent {
+	e := HookEvent{Action: action, User: user, IP: c.IP()}
+	if user != nil {
+		e.Email = user.Email
+	}
+	return e
+}
+
+// before runs every hook's Before in order and returns the first veto.
+func (a *Auth) before(c *fiber.Ctx, e HookEvent) error {
+	for _, h := range a.hooks {
+		if err := h.Before(c.UserContext(), e); err != nil {
+			a.requestLogger(c).Info("Action vetoed by hook", "action", e.Action, "reason", err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// after runs every hook's After in order.
+func (a *Auth) after(ctx context.Context, e HookEvent) {
+	for _, h := range a.hooks {
+		h.After(ctx, e)
+	}
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// recordingHook vetoes the actions in veto and keeps every event it sees.
+type recordingHook struct {
+	veto map[string]error
+
+	mu            sync.Mutex
+	before, after []HookEvent
+}
+
+func (h *recordingHook) Before(ctx context.Context, e HookEvent) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.before = append(h.before, e)
+	return h.veto[e.Action]
+}
+
+func (h *recordingHook) After(ctx context.Context, e HookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.after = append(h.after, e)
+}
+
+// seen returns the events of action that reached Before and After.
+func (h *recordingHook) seen(action string) (before, after []HookEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range h.before {
+		if e.Action == action {
+			before = append(before, e)
+		}
+	}
+	for _, e := range h.after {
+		if e.Action == action {
+			after = append(after, e)
+		}
+	}
+	return before, after
+}
+
+func TestBeforeHookVetoesRegistration(t *testing.T) {
+	e := newTestEnv(t)
+	veto := errors.New("Sign-ups are paused while we're migrating")
+	hook := &recordingHook{veto: map[string]error{ActionRegister: veto}}
+	e.auth.hooks = []Hook{hook}
+
+	_, page := e.client(t).register("user@example.com", testPassword, nil)
+	if !strings.Contains(page, html.EscapeString(veto.Error())) {
+		t.Error("the hook's message isn't shown")
+	}
+	before, after := hook.seen(ActionRegister)
+	if len(before) != 1 || before[0].Email != "user@example.com" || before[0].User != nil {
+		t.Errorf("Before got %+v", before)
+	}
+	if len(after) != 0 {
+		t.Errorf("After ran for a vetoed registration: %+v", after)
+	}
+	var pending int64
+	e.auth.db.Model(&PendingRegistration{}).Count(&pending)
+	if pending != 0 || e.mailCount("user@example.com") != 0 {
+		t.Error("a vetoed registration went ahead")
+	}
+}
+
+func TestAfterHookReceivesTheRegisteredUser(t *testing.T) {
+	e := newTestEnv(t)
+	hook := &recordingHook{}
+	e.auth.hooks = []Hook{hook}
+
+	user := e.registerUser(t, e.client(t), "user@example.com", testPassword)
+	_, after := hook.seen(ActionRegister)
+	if len(after) != 1 {
+		t.Fatalf("After ran %d times, want once", len(after))
+	}
+	if got := after[0].User; got == nil || got.ID != user.ID || got.Email != user.Email || after[0].Email != user.Email {
+		t.Errorf("After got user %+v, want the created account %d", got, user.ID)
+	}
+}
+
+func TestBeforeHookVetoesRegistrationWhenConfirmed(t *testing.T) {
+	e := newTestEnv(t)
+	hook := &recordingHook{veto: map[string]error{}}
+	e.auth.hooks = []Hook{hook}
+
+	c := e.client(t)
+	c.register("user@example.com", testPassword, nil)
+	link := linkIn(t, e.waitForMail(t, "user@example.com", 1))
+
+	// The hook starts refusing the address after the link went out.
+	veto := errors.New("We no longer accept sign-ups from example.com")
+	hook.mu.Lock()
+	hook.veto[ActionRegister] = veto
+	hook.mu.Unlock()
+
+	_, page := c.post(link, url.Values{"identifier": {"user@example.com"}, "password": {testPassword}})
+	if !strings.Contains(page, html.EscapeString(veto.Error())) {
+		t.Error("the hook's message isn't shown")
+	}
+	var users int64
+	e.auth.db.Model(&User{}).Where("email = ?", "user@example.com").Count(&users)
+	if users != 0 {
+		t.Error("the account was created")
+	}
+	before, after := hook.seen(ActionRegister)
+	if len(before) != 2 || before[1].User == nil || before[1].User.Email != "user@example.com" {
+		t.Errorf("Before got %+v, want a second call with the account about to be created", before)
+	}
+	if len(after) != 0 {
+		t.Errorf("After ran for a vetoed registration: %+v", after)
+	}
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusFound {
+		t.Errorf("dashboard after a vetoed confirmation: status %d, want a redirect", resp.StatusCode)
+	}
+}
+
+func TestBeforeHookVetoesLogin(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	veto := errors.New("Your subscription has lapsed")
+	hook := &recordingHook{veto: map[string]error{ActionLogin: veto}}
+	e.auth.hooks = []Hook{hook}
+
+	c := e.client(t)
+	if c.login("user@example.com", testPassword) {
+		t.Fatal("a vetoed login signs in")
+	}
+	_, page := c.post("/login", url.Values{"identifier": {"user@example.com"}, "password": {testPassword}})
+	if !strings.Contains(page, html.EscapeString(veto.Error())) {
+		t.Error("the hook's message isn't shown")
+	}
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusFound {
+		t.Errorf("dashboard after a vetoed login: status %d, want a redirect", resp.StatusCode)
+	}
+	before, after := hook.seen(ActionLogin)
+	if len(before) != 2 || before[0].User == nil || before[0].User.ID != user.ID || before[0].Method != "password" {
+		t.Errorf("Before got %+v", before)
+	}
+	if len(after) != 0 {
+		t.Errorf("After ran for a vetoed login: %+v", after)
+	}
+}
+
+func TestAfterHookReceivesTheSignedInUser(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	hook := &recordingHook{}
+	e.auth.hooks = []Hook{hook}
+
+	if !e.client(t).login("user@example.com", testPassword) {
+		t.Fatal("login failed")
+	}
+	_, after := hook.seen(ActionLogin)
+	if len(after) != 1 || after[0].User == nil || after[0].User.ID != user.ID || after[0].Method != "password" {
+		t.Errorf("After got %+v, want user %d signing in with a password", after, user.ID)
+	}
+}
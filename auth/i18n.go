@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// locale is a language the pages are translated into.
+type locale struct {
+	Code string
+	Name string
+	RTL  bool
+}
+
+// locales lists the supported languages. The first one is the default and
+// the fallback for messages missing from the others.
+var locales = []locale{
+	{Code: "en", Name: "English"},
+	{Code: "es", Name: "Español"},
+	{Code: "ar", Name: "العربية", RTL: true},
+}
+
+// languageCookie remembers the language picked with the switcher.
+const languageCookie = "lang"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// message is a translation. Messages with plural forms keep one text per
+// CLDR plural category; plain messages only have Other.
+type message map[plural.Form]string
+
+var pluralForms = map[string]plural.Form{
+	"zero": plural.Zero, "one": plural.One, "two": plural.Two,
+	"few": plural.Few, "many": plural.Many, "other": plural.Other,
+}
+
+func (m *message) UnmarshalJSON(b []byte) error {
+	var text string
+	if err := json.Unmarshal(b, &text); err == nil {
+		*m = message{plural.Other: text}
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(b, &forms); err != nil {
+		return err
+	}
+	*m = message{}
+	for name, text := range forms {
+		form, ok := pluralForms[name]
+		if !ok {
+			return fmt.Errorf("unknown plural form %q", name)
+		}
+		(*m)[form] = text
+	}
+	if _, ok := (*m)[plural.Other]; !ok {
+		return fmt.Errorf("plural message without an \"other\" form")
+	}
+	return nil
+}
+
+// catalogs maps a locale code to its messages.
+var catalogs = loadCatalogs()
+
+var languageMatcher = func() language.Matcher {
+	tags := make([]language.Tag, len(locales))
+	for i, l := range locales {
+		tags[i] = language.Make(l.Code)
+	}
+	return language.NewMatcher(tags)
+}()
+
+func loadCatalogs() map[string]map[string]message {
+	catalogs := map[string]map[string]message{}
+	for _, l := range locales {
+		data, err := localeFiles.ReadFile("locales/" + l.Code + ".json")
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]message
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("locales/%s.json: %v", l.Code, err))
+		}
+		catalogs[l.Code] = messages
+	}
+	return catalogs
+}
+
+// findLocale returns the supported locale for code, if any.
+func findLocale(code string) (locale, bool) {
+	for _, l := range locales {
+		if l.Code == code {
+			return l, true
+		}
+	}
+	return locale{}, false
+}
+
+// localizer translates messages into one locale.
+type localizer struct {
+	locale
+	tag language.Tag
+}
+
+// localizer returns the request's localizer. The signed-in user's
+// preference wins, then the language picked with the switcher, then the
+// best match for Accept-Language.
+func (a *Auth) localizer(c *fiber.Ctx) *localizer {
+	if l, ok := c.Locals(localizerKey).(*localizer); ok {
+		return l
+	}
+
+	loc := locales[0]
+	if user := CurrentUser(c); user != nil && user.Locale != "" {
+		if l, ok := findLocale(user.Locale); ok {
+			loc = l
+		}
+	} else if l, ok := findLocale(c.Cookies(languageCookie)); ok {
+		loc = l
+	} else if header := c.Get(fiber.HeaderAcceptLanguage); header != "" {
+		tags, _, _ := language.ParseAcceptLanguage(header)
+		if _, i, confidence := languageMatcher.Match(tags...); confidence != language.No {
+			loc = locales[i]
+		}
+	}
+
+	l := &localizer{locale: loc, tag: language.Make(loc.Code)}
+	c.Locals(localizerKey, l)
+	return l
+}
+
+// mailLocalizer returns the localizer for mail to recipient: the language
+// they picked if they have an account and picked one, the request's
+// otherwise.
+func (a *Auth) mailLocalizer(c *fiber.Ctx, recipient *User) *localizer {
+	if recipient != nil && recipient.Locale != "" {
+		if loc, ok := findLocale(recipient.Locale); ok {
+			return &localizer{locale: loc, tag: language.Make(loc.Code)}
+		}
+	}
+	return a.localizer(c)
+}
+
+// lookup returns the text of key for n, falling back to the default
+// locale and then to the key itself.
+func (l *localizer) lookup(key string, n int) string {
+	m, ok := catalogs[l.Code][key]
+	tag := l.tag
+	if !ok {
+		if m, ok = catalogs[locales[0].Code][key]; !ok {
+			return key
+		}
+		tag = language.Make(locales[0].Code)
+	}
+	if text, ok := m[plural.Cardinal.MatchPlural(tag, n, 0, 0, 0, 0)]; ok {
+		return text
+	}
+	return m[plural.Other]
+}
+
+// T returns the plain-text translation of key formatted with args.
+func (l *localizer) T(key string, args ...any) string {
+	text := l.lookup(key, 0)
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// H returns the translation of key formatted with args and escaped for
+// HTML.
+func (l *localizer) H(key string, args ...any) string {
+	return html.EscapeString(l.T(key, args...))
+}
+
+// N returns the translation of key in the plural form for n, formatted
+// with n followed by args.
+func (l *localizer) N(key string, n int, args ...any) string {
+	return fmt.Sprintf(l.lookup(key, n), append([]any{n}, args...)...)
+}
+
+// Err translates the user-facing errors the package returns, and returns
+// any other error's message unchanged.
+func (l *localizer) Err(err error) string {
+	if key, ok := errorMessages[err]; ok {
+		return l.T(key)
+	}
+	return err.Error()
+}
+
+// Date formats t as a long date.
+func (l *localizer) Date(t time.Time) string {
+	return l.T("date.long", t.Day(), l.T(fmt.Sprintf("month.%d", t.Month())), t.Year())
+}
+
+// Duration formats d in whole days, hours or minutes, the largest unit
+// that divides it, rounding seconds up to a minute.
+func (l *localizer) Duration(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d >= day && d%day == 0:
+		return l.N("duration.days", int(d/day))
+	case d >= time.Hour && d%time.Hour == 0:
+		return l.N("duration.hours", int(d/time.Hour))
+	default:
+		return l.N("duration.minutes", int((d+time.Minute-1)/time.Minute))
+	}
+}
+
+var errorMessages = map[error]string{
+	errInvalidInvite:    "error.invite_invalid",
+	errInviteOtherEmail: "error.invite_other_email",
+	errPhoneInvalid:     "error.phone_invalid",
+	errPhoneCountryCode: "error.phone_country_code",
+	errPhoneTooShort:    "error.phone_too_short",
+	errPhoneTooLong:     "error.phone_too_long",
+}
+
+// placeholder matches {{key}} and {{js:key}} in page templates.
+var placeholder = regexp.MustCompile(`\{\{(js:)?([a-z0-9_.]+)\}\}`)
+
+// Page replaces the placeholders in a page template before it is passed
+// to fmt.Sprintf: {{key}} becomes the HTML-escaped translation of key and
+// {{js:key}} one escaped for a JavaScript string. {{lang}} and {{dir}} give
+// the values for the <html> element.
+func (l *localizer) Page(tmpl string) string {
+	return placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		parts := placeholder.FindStringSubmatch(m)
+		var text string
+		switch key := parts[2]; {
+		case key == "lang":
+			text = l.Code
+		case key == "dir":
+			text = l.Dir()
+		case parts[1] != "":
+			text = jsString(l.T(key))
+		default:
+			text = html.EscapeString(l.T(key))
+		}
+		return strings.ReplaceAll(text, "%", "%%")
+	})
+}
+
+// jsString escapes text for a single- or double-quoted JavaScript string.
+// Quotes become unicode escapes so the result is also safe inside an HTML
+// attribute.
+func jsString(text string) string {
+	text = template.JSEscapeString(text)
+	return strings.NewReplacer(`\'`, `\u0027`, `\"`, `\u0022`).Replace(text)
+}
+
+// Dir returns the text direction of the locale.
+func (l *localizer) Dir() string {
+	if l.RTL {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// renderLanguageSwitcher renders the language picker. It returns to the
+// current page, or to page after a form submission.
+func (a *Auth) renderLanguageSwitcher(c *fiber.Ctx, page string) string {
+	next := page
+	if c.Method() == fiber.MethodGet {
+		next = c.OriginalURL()
+	}
+
+	l := a.localizer(c)
+	var options strings.Builder
+	for _, loc := range locales {
+		selected := ""
+		if loc.Code == l.Code {
+			selected = " selected"
+		}
+		fmt.Fprintf(&options, `<option value="%s" lang="%s"%s>%s</option>`, loc.Code, loc.Code, selected, html.EscapeString(loc.Name))
+	}
+	return fmt.Sprintf(`<form method="POST" action="%s" class="language-switcher">
+                <input type="hidden" name="next" value="%s">
+                <select name="lang" aria-label="%s" data-autosubmit>%s</select>
+            </form>`, a.path("/language"), html.EscapeString(next), html.EscapeString(l.T("language.label")), options.String())
+}
+
+// handleLanguage stores the picked language in a cookie and, for users
+// whose session hasn't expired, as their preference, then returns to the
+// page it was picked on.
+func (a *Auth) handleLanguage(c *fiber.Ctx) error {
+	loc, ok := findLocale(c.FormValue("lang"))
+	if !ok {
+		return fiber.ErrBadRequest
+	}
+	a.setLanguageCookie(c, loc.Code)
+
+	if sess, err := a.loadSession(c); err == nil {
+		if userID, ok := sess.Get("userID").(uint); ok && a.sessionExpired(sess) == "" {
+			a.dbFor(c).Model(&User{}).Where("id = ?", userID).Update("locale", loc.Code)
+		}
+	}
+
+	next := c.FormValue("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = a.path("/login")
+	}
+	return c.Redirect(next)
+}
+
+// setLanguageCookie remembers code as the browser's language for a year.
+func (a *Auth) setLanguageCookie(c *fiber.Ctx, code string) {
+	c.Cookie(&fiber.Cookie{
+		Name:     languageCookie,
+		Value:    code,
+		Path:     "/",
+		Expires:  time.Now().Add(365 * 24 * time.Hour),
+		Secure:   a.store.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
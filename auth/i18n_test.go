@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLocalizerDuration(t *testing.T) {
+	l := englishLocalizer()
+	for d, want := range map[time.Duration]string{
+		time.Minute:         "1 minute",
+		15 * time.Minute:    "15 minutes",
+		90 * time.Second:    "2 minutes",
+		24 * time.Hour:      "1 day",
+		36 * time.Hour:      "36 hours",
+		14 * 24 * time.Hour: "14 days",
+	} {
+		if got := l.Duration(d); got != want {
+			t.Errorf("Duration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestLanguageIsOnlySavedForLiveSessions(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	c := e.client(t)
+	c.login("user@example.com", testPassword)
+	locale := func() string {
+		var u User
+		e.auth.db.First(&u, user.ID)
+		return u.Locale
+	}
+
+	c.post("/language", url.Values{"lang": {"es"}, "next": {"/dashboard"}})
+	if got := locale(); got != "es" {
+		t.Fatalf("locale = %q, want es", got)
+	}
+
+	// Every session is now past its idle timeout.
+	e.auth.idleTimeout = -time.Second
+	resp, _ := c.post("/language", url.Values{"lang": {"ar"}, "next": {"/dashboard"}})
+	if got := locale(); got != "es" {
+		t.Errorf("an expired session changed the stored locale to %q", got)
+	}
+	if resp.StatusCode != fiber.StatusFound || c.cookies[languageCookie] == nil || c.cookies[languageCookie].Value != "ar" {
+		t.Error("the browser's language wasn't switched")
+	}
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Registration modes.
+const (
+	registrationOpen       = "open"
+	registrationInviteOnly = "invite-only"
+	registrationClosed     = "closed"
+)
+
+// User roles.
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+var (
+	errInvalidInvite    = errors.New("This invitation is invalid, expired or used up")
+	errInviteOtherEmail = errors.New("This invitation was sent to a different email address")
+)
+
+// Invitation lets people register while registration is invite-only. The
+// code is shown to its creator once; only its hash is stored. An invitation
+// addressed to an email can only be redeemed by that address.
+type Invitation struct {
+	ID              uint      `gorm:"primaryKey"`
+	CodeHash        string    `gorm:"uniqueIndex;size:64;not null"`
+	CreatedByID     uint      `gorm:"index;not null"`
+	Email           string    `gorm:"size:255"`
+	EmailNormalized string    `gorm:"size:255"`
+	Role            string    `gorm:"size:32;not null"`
+	MaxUses         int       `gorm:"not null"`
+	Uses            int       `gorm:"not null;default:0"`
+	ExpiresAt       time.Time `gorm:"not null"`
+	RevokedAt       *time.Time
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+// Usable reports whether the invitation can still be redeemed.
+func (inv *Invitation) Usable(now time.Time) bool {
+	return inv.RevokedAt == nil && now.Before(inv.ExpiresAt) && inv.Uses < inv.MaxUses
+}
+
+func (a *Auth) canInvite(user *User) bool {
+	return user.Role == roleAdmin || a.cfg.UsersCanInvite
+}
+
+// promoteAdmins grants the admin role to every account listed in
+// Config.AdminEmails.
+func (a *Auth) promoteAdmins() {
+	for _, raw := range a.cfg.AdminEmails {
+		_, normalized, err := a.normalizeEmail(raw)
+		if err != nil {
+			a.logger.Warn("Ignoring invalid admin email", "value", raw)
+			continue
+		}
+		a.db.Model(&User{}).Where("email_normalized = ?", normalized).Update("role", roleAdmin)
+	}
+}
+
+// findInvitation returns the usable invitation for code, checking that it
+// may be redeemed by normalizedEmail.
+func (a *Auth) findInvitation(code, normalizedEmail string) (*Invitation, error) {
+	var inv Invitation
+	if err := a.db.Where("code_hash = ?", hashToken(strings.TrimSpace(code))).First(&inv).Error; err != nil {
+		return nil, errInvalidInvite
+	}
+	if !inv.Usable(time.Now()) {
+		return nil, errInvalidInvite
+	}
+	if inv.EmailNormalized != "" && inv.EmailNormalized != normalizedEmail {
+		return nil, errInviteOtherEmail
+	}
+	return &inv, nil
+}
+
+// redeemInvitation consumes one use of inv inside tx, failing if another
+// registration used it up first.
+func redeemInvitation(tx *gorm.DB, inv *Invitation) error {
+	result := tx.Model(&Invitation{}).
+		Where("id = ? AND uses < max_uses AND revoked_at IS NULL", inv.ID).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errInvalidInvite
+	}
+	return nil
+}
+
+func (a *Auth) handleInvitationCreate(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	user := CurrentUser(c)
+	if !a.canInvite(user) {
+		return fiber.ErrForbidden
+	}
+
+	maxUses, err := strconv.Atoi(c.FormValue("max_uses", "1"))
+	if err != nil || maxUses < 1 || maxUses > 1000 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("invitations.invalid_max_uses"), ""))
+	}
+	days, err := strconv.Atoi(c.FormValue("expires_in_days", "7"))
+	if err != nil || days < 1 || days > 365 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("invitations.invalid_expiry"), ""))
+	}
+
+	role := roleUser
+	if user.Role == roleAdmin && c.FormValue("role") == roleAdmin {
+		role = roleAdmin
+	}
+
+	inv := Invitation{
+		CreatedByID: user.ID,
+		Role:        role,
+		MaxUses:     maxUses,
+		ExpiresAt:   time.Now().Add(time.Duration(days) * 24 * time.Hour),
+	}
+	if raw := strings.TrimSpace(c.FormValue("email")); raw != "" {
+		email, normalized, err := a.normalizeEmail(raw)
+		if err != nil {
+			c.Type("html")
+			return c.SendString(a.renderDashboard(c, l.H("invitations.invalid_email"), ""))
+		}
+		inv.Email, inv.EmailNormalized = email, normalized
+	}
+
+	code := randomToken(12)
+	inv.CodeHash = hashToken(code)
+	if err := a.dbFor(c).Create(&inv).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("invitations.create_failed"), ""))
+	}
+
+	link := a.url("/register?invite=" + url.QueryEscape(code))
+	if inv.Email != "" {
+		ml := a.mailLocalizer(c, nil)
+		a.sendMail(Mail{
+			To:      inv.Email,
+			Subject: ml.T("mail.invitation.subject", a.theme.ProductName),
+			Body:    ml.T("mail.invitation.body", user.Email, a.theme.ProductName, link, ml.Date(inv.ExpiresAt)),
+		})
+	}
+
+	c.Type("html")
+	return c.SendString(a.renderDashboard(c, "", fmt.Sprintf(
+		l.H("invitations.created")+"<br><a href=\"%s\">%s</a>",
+		"<code>"+code+"</code>", html.EscapeString(link), html.EscapeString(link))))
+}
+
+func (a *Auth) handleInvitationRevoke(c *fiber.Ctx) error {
+	user := CurrentUser(c)
+
+	var inv Invitation
+	if err := a.dbFor(c).First(&inv, c.Params("id")).Error; err != nil {
+		return fiber.ErrNotFound
+	}
+	if inv.CreatedByID != user.ID && user.Role != roleAdmin {
+		return fiber.ErrForbidden
+	}
+	if inv.RevokedAt == nil {
+		a.dbFor(c).Model(&inv).Update("revoked_at", time.Now())
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// renderInvitationsPanel lists the invitations visible to user (all of them
+// for admins) with a form to create more.
+func (a *Auth) renderInvitationsPanel(l *localizer, user *User) string {
+	if !a.canInvite(user) {
+		return ""
+	}
+
+	var invitations []Invitation
+	query := a.db.Order("created_at DESC").Limit(20)
+	if user.Role != roleAdmin {
+		query = query.Where("created_by_id = ?", user.ID)
+	}
+	query.Find(&invitations)
+
+	now := time.Now()
+	var rows strings.Builder
+	for _, inv := range invitations {
+		status := "active"
+		switch {
+		case inv.RevokedAt != nil:
+			status = "revoked"
+		case !now.Before(inv.ExpiresAt):
+			status = "expired"
+		case inv.Uses >= inv.MaxUses:
+			status = "used_up"
+		}
+		recipient := inv.Email
+		if recipient == "" {
+			recipient = l.T("invitations.anyone")
+		}
+		action := ""
+		if status == "active" {
+			action = fmt.Sprintf(`<form method="POST" action="%s/invitations/%d/revoke" class="bare-form"><button type="submit" class="danger-btn">%s</button></form>`, a.basePath, inv.ID, l.H("invitations.revoke"))
+		}
+		fmt.Fprintf(&rows, `<tr><td>%s</td><td>%s</td><td>%d / %d</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			html.EscapeString(recipient), l.H("role."+inv.Role), inv.Uses, inv.MaxUses, html.EscapeString(l.Date(inv.ExpiresAt)), l.H("invitations.status."+status), action)
+	}
+
+	table := `<p class="empty-text">` + l.H("invitations.none") + `</p>`
+	if rows.Len() > 0 {
+		table = l.Page(`<table class="account-table"><tr><th>{{invitations.for}}</th><th>{{members.role}}</th><th>{{invitations.uses}}</th><th>{{invitations.expires}}</th><th>{{invitations.status}}</th><th></th></tr>`) + rows.String() + `</table>`
+	}
+
+	roleSelect := ""
+	if user.Role == roleAdmin {
+		roleSelect = l.Page(`<select name="role"><option value="user">{{role.user}}</option><option value="admin">{{role.admin}}</option></select>`)
+	}
+
+	return fmt.Sprintf(l.Page(`<section class="account-panel">
+            <h3>{{invitations.title}}</h3>
+            <form method="POST" action="%s" class="account-stack">
+                <input type="email" name="email" placeholder="{{invitations.email}}">
+                <div class="account-row flush">
+                    <input type="number" name="max_uses" value="1" min="1" max="1000" title="{{invitations.max_uses}}">
+                    <input type="number" name="expires_in_days" value="7" min="1" max="365" title="{{invitations.expires_in_days}}">
+                    %s
+                </div>
+                <button type="submit" class="account-btn">{{invitations.create}}</button>
+            </form>
+            %s
+        </section>`), a.path("/invitations"), roleSelect, table)
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+)
+
+var shownCode = regexp.MustCompile(`<code>([^<]+)</code>`)
+
+// createInvitation creates an invitation from c's dashboard and returns
+// its code.
+func createInvitation(t *testing.T, c *testClient, form url.Values) string {
+	t.Helper()
+	_, page := c.post("/invitations", form)
+	match := shownCode.FindStringSubmatch(page)
+	if match == nil {
+		t.Fatal("no invitation code shown")
+	}
+	return match[1]
+}
+
+func TestInviteOnlyRegistrationNeedsACode(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) { cfg.RegistrationMode = registrationInviteOnly })
+	e.createUser(t, "inviter@example.com", testPassword, true)
+	inviter := e.client(t)
+	inviter.login("inviter@example.com", testPassword)
+	code := createInvitation(t, inviter, url.Values{"max_uses": {"1"}})
+
+	c := e.client(t)
+	c.register("nocode@example.com", testPassword, nil)
+	c.register("badcode@example.com", testPassword, url.Values{"invite_code": {"not-a-code"}})
+	if e.mailCount("nocode@example.com")+e.mailCount("badcode@example.com") != 0 {
+		t.Fatal("registered without a valid invitation code")
+	}
+
+	user := e.registerWith(t, c, "first@example.com", testPassword, url.Values{"invite_code": {code}})
+	if user.Role != roleUser {
+		t.Errorf("role = %q", user.Role)
+	}
+	e.client(t).register("second@example.com", testPassword, url.Values{"invite_code": {code}})
+	if e.mailCount("second@example.com") != 0 {
+		t.Error("a single-use code was used twice")
+	}
+}
+
+func TestInvitationForAnAddressOnlyWorksForIt(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) { cfg.RegistrationMode = registrationInviteOnly })
+	e.createUser(t, "inviter@example.com", testPassword, true)
+	inviter := e.client(t)
+	inviter.login("inviter@example.com", testPassword)
+	createInvitation(t, inviter, url.Values{"email": {"invitee@example.com"}})
+	link := linkIn(t, e.waitForMail(t, "invitee@example.com", 1))
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := u.Query().Get("invite")
+
+	e.client(t).register("someone-else@example.com", testPassword, url.Values{"invite_code": {code}})
+	if e.mailCount("someone-else@example.com") != 0 {
+		t.Error("another address registered with the invitation")
+	}
+	e.registerWith(t, e.client(t), "invitee@example.com", testPassword, url.Values{"invite_code": {code}})
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"html"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// magicLinkCookie binds a sign-in link to the browser that requested it.
+const magicLinkCookie = "magic_link_binding"
+
+// MagicLinkToken is a single-use passwordless sign-in token. Only hashes of
+// the emailed token and of the browser binding are stored.
+type MagicLinkToken struct {
+	ID          uint       `gorm:"primaryKey" json:"-"`
+	UserID      uint       `gorm:"index;not null" json:"-"`
+	TokenHash   string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	BrowserHash string     `gorm:"size:64;not null" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+func (a *Auth) handleMagicLinkRequest(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	identifier := c.FormValue("identifier")
+	if identifier == "" {
+		identifier = c.FormValue("email")
+	}
+
+	// Reusing the browser's binding keeps its earlier link working when a
+	// repeated request is throttled.
+	binding := c.Cookies(magicLinkCookie)
+	if binding == "" {
+		binding = randomToken(32)
+	}
+	a.setMagicLinkCookie(c, binding, time.Now().Add(a.cfg.MagicLinkTTL))
+
+	if user, err := a.findUserByIdentifier(c.UserContext(), identifier); err == nil && !a.magicLinkThrottled(c, user.ID) {
+		token := randomToken(32)
+
+		// Only the most recent link works.
+		a.dbFor(c).Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&MagicLinkToken{})
+		a.dbFor(c).Create(&MagicLinkToken{
+			UserID:      user.ID,
+			TokenHash:   hashToken(token),
+			BrowserHash: hashToken(binding),
+			ExpiresAt:   time.Now().Add(a.cfg.MagicLinkTTL),
+		})
+
+		ml := a.mailLocalizer(c, user)
+		a.sendMail(Mail{
+			To:      user.Email,
+			Subject: ml.T("mail.magic_link.subject", a.theme.ProductName),
+			Body:    ml.T("mail.magic_link.body", ml.Duration(a.cfg.MagicLinkTTL), a.url("/login/magic?token="+url.QueryEscape(token))),
+		})
+	}
+
+	// Same response whether or not the account exists or was throttled.
+	c.Type("html")
+	return c.SendString(a.renderLoginPage(c, "", l.H("magic_link.sent")))
+}
+
+// magicLinkThrottled reports whether userID was sent a link that is still
+// unused less than MagicLinkInterval ago.
+func (a *Auth) magicLinkThrottled(c *fiber.Ctx, userID uint) bool {
+	var recent int64
+	a.dbFor(c).Model(&MagicLinkToken{}).
+		Where("user_id = ? AND used_at IS NULL AND created_at > ?", userID, time.Now().Add(-a.cfg.MagicLinkInterval)).
+		Count(&recent)
+	if recent > 0 {
+		a.requestLogger(c).Info("Magic link request throttled", "user_id", userID)
+		return true
+	}
+	return false
+}
+
+// setMagicLinkCookie sets the browser binding cookie, or deletes it when
+// expires is in the past. It is scoped to the magic-link path, which a
+// deletion has to repeat for the browser to drop it.
+func (a *Auth) setMagicLinkCookie(c *fiber.Ctx, binding string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     magicLinkCookie,
+		Value:    binding,
+		Path:     a.path("/login/magic"),
+		Expires:  expires,
+		Secure:   a.store.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func (a *Auth) handleMagicLinkLogin(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	var token MagicLinkToken
+	if err := a.dbFor(c).Where("token_hash = ?", hashToken(c.Query("token"))).First(&token).Error; err != nil ||
+		token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		a.metrics.loginFailuresTotal.WithLabelValues(loginFailureInvalidLink).Inc()
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("magic_link.invalid"), ""))
+	}
+
+	// Checked before the token is consumed so link scanners and other
+	// browsers can't burn it.
+	binding := c.Cookies(magicLinkCookie)
+	if binding == "" || subtle.ConstantTimeCompare([]byte(hashToken(binding)), []byte(token.BrowserHash)) != 1 {
+		a.metrics.loginFailuresTotal.WithLabelValues(loginFailureOtherBrowser).Inc()
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("magic_link.other_browser"), ""))
+	}
+
+	now := time.Now()
+	result := a.dbFor(c).Model(&MagicLinkToken{}).Where("id = ? AND used_at IS NULL", token.ID).Update("used_at", now)
+	if result.Error != nil || result.RowsAffected != 1 {
+		a.metrics.loginFailuresTotal.WithLabelValues(loginFailureInvalidLink).Inc()
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("magic_link.invalid"), ""))
+	}
+	a.setMagicLinkCookie(c, "", time.Unix(0, 0))
+
+	var user User
+	if err := a.dbFor(c).First(&user, token.UserID).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("magic_link.invalid"), ""))
+	}
+	// Opening the emailed link proves the user reads mail for the address.
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+		a.dbFor(c).Model(&user).Update("email_verified_at", now)
+	}
+
+	event := newHookEvent(c, ActionLogin, &user)
+	event.Method = "magic_link"
+	if err := a.before(c, event); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, html.EscapeString(err.Error()), ""))
+	}
+
+	if err := a.signIn(c, &user); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("login.failed"), ""))
+	}
+	a.recordAuthEvent(c, user.ID, eventMagicLinkLogin)
+	a.metrics.loginsTotal.WithLabelValues("magic_link").Inc()
+	a.after(c.UserContext(), event)
+
+	return c.Redirect(a.path("/dashboard"))
+}
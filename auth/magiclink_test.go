@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMagicLinkSignsInTheRequestingBrowser(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, false)
+	l := englishLocalizer()
+
+	c := e.client(t)
+	c.post("/login/magic", url.Values{"identifier": {"user@example.com"}})
+	link := linkIn(t, e.waitForMail(t, "user@example.com", 1))
+
+	// Another browser, such as a mail scanner, neither signs in nor uses
+	// the link up.
+	if _, page := e.client(t).get(link); !strings.Contains(page, l.H("magic_link.other_browser")) {
+		t.Error("the link works in a browser that didn't ask for it")
+	}
+	if resp, _ := c.get(link); resp.StatusCode != fiber.StatusFound || resp.Header.Get(fiber.HeaderLocation) != "/dashboard" {
+		t.Fatalf("opening the link: status %d to %q", resp.StatusCode, resp.Header.Get(fiber.HeaderLocation))
+	}
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("dashboard: status %d", resp.StatusCode)
+	}
+	e.auth.db.First(user, user.ID)
+	if user.EmailVerifiedAt == nil {
+		t.Error("signing in from the emailed link didn't confirm the address")
+	}
+
+	if _, page := e.client(t).get(link); !strings.Contains(page, l.H("magic_link.invalid")) {
+		t.Error("the link works twice")
+	}
+}
+
+func TestMagicLinkRequestsAreThrottled(t *testing.T) {
+	e := newTestEnv(t)
+	e.createUser(t, "user@example.com", testPassword, true)
+
+	c := e.client(t)
+	c.post("/login/magic", url.Values{"identifier": {"user@example.com"}})
+	c.post("/login/magic", url.Values{"identifier": {"user@example.com"}})
+	e.waitForMail(t, "user@example.com", 1)
+	if n := e.mailCount("user@example.com"); n != 1 {
+		t.Errorf("two requests in a row sent %d links", n)
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+)
+
+// Mail is a plain-text message to a single recipient.
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers mail. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(msg Mail) error
+}
+
+// MailerFromEnv returns the mailer selected by MAIL_DRIVER: log (the
+// default), file (writing to MAIL_DIR) or memory.
+func MailerFromEnv(logger *slog.Logger) (Mailer, error) {
+	driver := env.String("MAIL_DRIVER", "log")
+	if os.Getenv("MAIL_DIR") != "" && os.Getenv("MAIL_DRIVER") == "" {
+		driver = "file"
+	}
+
+	switch driver {
+	case "log":
+		return LogMailer{Logger: logger, LogBody: env.Bool("MAIL_LOG_BODY", false)}, nil
+	case "file":
+		dir := env.String("MAIL_DIR", "mail")
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("create MAIL_DIR: %w", err)
+		}
+		return FileMailer{Dir: dir}, nil
+	case "memory":
+		return &MemoryMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q, want log, file or memory", driver)
+	}
+}
+
+// sendMail delivers msg in the background so the time taken by the mailer
+// never shows up in response times.
+func (a *Auth) sendMail(msg Mail) {
+	go func() {
+		if err := a.mailer.Send(msg); err != nil {
+			a.logger.Warn("Failed to send mail", "subject", msg.Subject, "error", err)
+		}
+	}()
+}
+
+// LogMailer writes the recipient and subject of messages to Logger. Bodies
+// hold sign-in links and invitation codes, so they are only logged when
+// LogBody is set, for local development.
+type LogMailer struct {
+	Logger  *slog.Logger
+	LogBody bool
+}
+
+func (m LogMailer) Send(msg Mail) error {
+	if m.LogBody {
+		m.Logger.Info("Mail", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+		return nil
+	}
+	m.Logger.Info("Mail", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// FileMailer writes each message as an .eml file in Dir.
+type FileMailer struct {
+	Dir string
+}
+
+func (m FileMailer) Send(msg Mail) error {
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFilename(msg.To))
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		msg.To, msg.Subject, time.Now().Format(time.RFC1123Z), msg.Body)
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(content), 0o600)
+}
+
+// MemoryMailer keeps sent messages in memory, for tests and local
+// development.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []Mail
+}
+
+func (m *MemoryMailer) Send(msg Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of every message sent so far.
+func (m *MemoryMailer) Sent() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mail(nil), m.sent...)
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func localizerFor(t *testing.T, code string) *localizer {
+	t.Helper()
+	loc, ok := findLocale(code)
+	if !ok {
+		t.Fatalf("no locale %q", code)
+	}
+	return &localizer{locale: loc, tag: language.Make(code)}
+}
+
+func TestMailsFollowTheRecipientsLanguage(t *testing.T) {
+	e := newTestEnv(t)
+	product := e.auth.theme.ProductName
+	es, ar := localizerFor(t, "es"), localizerFor(t, "ar")
+
+	// New addresses get the language of the browser that registered them.
+	spanish := e.client(t)
+	spanish.cookies[languageCookie] = &http.Cookie{Name: languageCookie, Value: "es"}
+	spanish.register("nuevo@example.com", testPassword, nil)
+	if m := e.waitForMail(t, "nuevo@example.com", 1); m.Subject != es.T("mail.registration.subject", product) ||
+		!strings.Contains(m.Body, es.Duration(e.auth.cfg.RegistrationLinkTTL)) {
+		t.Errorf("confirmation mail from a Spanish browser: %q\n%s", m.Subject, m.Body)
+	}
+
+	// Account holders get the language they picked, whoever triggers it.
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	e.auth.db.Model(user).Update("locale", "ar")
+	e.client(t).register("user@example.com", testPassword, nil)
+	if m := e.waitForMail(t, "user@example.com", 1); m.Subject != ar.T("mail.register_taken.subject") {
+		t.Errorf("registration attempt mail: %q, want Arabic", m.Subject)
+	}
+	e.client(t).post("/login/magic", url.Values{"identifier": {"user@example.com"}})
+	if m := e.waitForMail(t, "user@example.com", 2); m.Subject != ar.T("mail.magic_link.subject", product) {
+		t.Errorf("sign-in link mail: %q, want Arabic", m.Subject)
+	}
+
+	e.createUser(t, "owner@example.com", testPassword, true)
+	owner := e.client(t)
+	owner.login("owner@example.com", testPassword)
+	e.inviteToWorkspace(t, owner, "user@example.com")
+	if m := e.waitForMail(t, "user@example.com", 3); m.Subject != ar.T("mail.org_invitation.subject", "Acme", product) ||
+		!strings.Contains(m.Body, ar.T("role.member")) {
+		t.Errorf("workspace invitation mail: %q, want Arabic\n%s", m.Subject, m.Body)
+	}
+}
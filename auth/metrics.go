@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a login attempt failed, used as the reason label.
+const (
+	loginFailureUnknownAccount = "unknown_account"
+	loginFailureWrongPassword  = "wrong_password"
+	loginFailureInvalidLink    = "invalid_link"
+	loginFailureOtherBrowser   = "other_browser"
+)
+
+// metrics are the module's Prometheus collectors.
+type metrics struct {
+	loginsTotal            *prometheus.CounterVec
+	loginFailuresTotal     *prometheus.CounterVec
+	registrationsTotal     prometheus.Counter
+	logoutsTotal           prometheus.Counter
+	passwordHashDuration   *prometheus.HistogramVec
+	droppedAuthEventsTotal *prometheus.CounterVec
+}
+
+// newMetrics registers the collectors with reg. Collectors another Auth
+// already registered there are shared rather than rejected.
+func newMetrics(reg prometheus.Registerer) (*metrics, error) {
+	m := &metrics{}
+	var err error
+	if m.loginsTotal, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_logins_total",
+		Help: "Successful logins by method.",
+	}, []string{"method"})); err != nil {
+		return nil, err
+	}
+	if m.loginFailuresTotal, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_failures_total",
+		Help: "Failed login attempts by reason.",
+	}, []string{"reason"})); err != nil {
+		return nil, err
+	}
+	if m.registrationsTotal, err = register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_registrations_total",
+		Help: "Accounts created.",
+	})); err != nil {
+		return nil, err
+	}
+	if m.logoutsTotal, err = register(reg, prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "auth_logouts_total",
+		Help: "Explicit logouts.",
+	})); err != nil {
+		return nil, err
+	}
+	if m.passwordHashDuration, err = register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "auth_password_hash_duration_seconds",
+		Help:    "Time spent hashing and verifying passwords.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"algorithm", "operation"})); err != nil {
+		return nil, err
+	}
+	if m.droppedAuthEventsTotal, err = register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_dropped_events_total",
+		Help: "Auth events not recorded because the background queue was full, by type.",
+	}, []string{"type"})); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// register registers c with reg, returning the identical collector that is
+// already registered, if any.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// observePasswordHash records how long a hash or verify with h took.
+func (m *metrics) observePasswordHash(h PasswordHasher, operation string, start time.Time) {
+	m.passwordHashDuration.WithLabelValues(hasherName(h), operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// OrgInvitation invites an email address into an organization. It is
+// matched to an account by normalized email, so it works whether the
+// invitee already has an account or signs up later, but only accounts that
+// proved they read mail for the address can respond to it. The emailed link
+// carries a token, of which only the hash is stored, that lets the invitee
+// register while registration is invite-only.
+type OrgInvitation struct {
+	ID              uint         `gorm:"primaryKey"`
+	OrganizationID  uint         `gorm:"index;not null"`
+	TokenHash       string       `gorm:"index;size:64"`
+	Email           string       `gorm:"size:255;not null"`
+	EmailNormalized string       `gorm:"index;size:255;not null"`
+	Role            string       `gorm:"size:32;not null"`
+	InvitedByID     uint         `gorm:"not null"`
+	ExpiresAt       time.Time    `gorm:"not null"`
+	RespondedAt     *time.Time   // accepted, declined or revoked
+	CreatedAt       time.Time    `gorm:"autoCreateTime"`
+	Organization    Organization `json:"-"`
+}
+
+// pendingOrgInvitations returns the open invitations addressed to
+// normalizedEmail.
+func (a *Auth) pendingOrgInvitations(normalizedEmail string) []OrgInvitation {
+	var invitations []OrgInvitation
+	a.db.Joins("Organization").
+		Where("org_invitations.email_normalized = ? AND org_invitations.responded_at IS NULL AND org_invitations.expires_at > ?", normalizedEmail, time.Now()).
+		Find(&invitations)
+	return invitations
+}
+
+// orgInvitationByToken returns the open invitation whose emailed link
+// carries token, or nil.
+func (a *Auth) orgInvitationByToken(token string) *OrgInvitation {
+	if token == "" {
+		return nil
+	}
+	var inv OrgInvitation
+	if err := a.db.Where("token_hash = ? AND responded_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).First(&inv).Error; err != nil {
+		return nil
+	}
+	return &inv
+}
+
+// findMember returns the membership of userID in orgID.
+func (a *Auth) findMember(orgID uint, userID string) (*Membership, error) {
+	var m Membership
+	if err := a.db.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&m).Error; err != nil {
+		return nil, fiber.ErrNotFound
+	}
+	return &m, nil
+}
+
+func (a *Auth) handleOrgInvitationCreate(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	user := CurrentUser(c)
+	current := CurrentMembership(c)
+
+	if current.Organization.Personal {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("members.personal_workspace"), ""))
+	}
+
+	email, normalized, err := a.normalizeEmail(c.FormValue("email"))
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("invitations.invalid_email"), ""))
+	}
+
+	role := orgRoleMember
+	if c.FormValue("role") == orgRoleAdmin {
+		if current.Role != orgRoleOwner {
+			return fiber.ErrForbidden
+		}
+		role = orgRoleAdmin
+	}
+
+	var members int64
+	a.dbFor(c).Model(&Membership{}).Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.organization_id = ? AND users.email_normalized = ?", current.OrganizationID, normalized).Count(&members)
+	if members > 0 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("members.already_member", email), ""))
+	}
+
+	// Re-inviting replaces any open invitation for the same address.
+	now := time.Now()
+	a.dbFor(c).Model(&OrgInvitation{}).
+		Where("organization_id = ? AND email_normalized = ? AND responded_at IS NULL", current.OrganizationID, normalized).
+		Update("responded_at", now)
+
+	token := randomToken(32)
+	inv := OrgInvitation{
+		OrganizationID:  current.OrganizationID,
+		TokenHash:       hashToken(token),
+		Email:           email,
+		EmailNormalized: normalized,
+		Role:            role,
+		InvitedByID:     user.ID,
+		ExpiresAt:       now.Add(a.cfg.OrgInvitationTTL),
+	}
+	if err := a.dbFor(c).Create(&inv).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("invitations.create_failed"), ""))
+	}
+
+	// Write in the invitee's language if they already have an account.
+	var invitee User
+	a.dbFor(c).Select("locale").Where("email_normalized = ?", normalized).Limit(1).Find(&invitee)
+	ml := a.mailLocalizer(c, &invitee)
+	a.sendMail(Mail{
+		To:      email,
+		Subject: ml.T("mail.org_invitation.subject", current.Organization.Name, a.theme.ProductName),
+		Body: ml.T("mail.org_invitation.body", user.Email, current.Organization.Name, ml.T("role."+role),
+			a.url("/login"), a.url("/register?workspace_invite="+url.QueryEscape(token)), ml.Date(inv.ExpiresAt)),
+	})
+
+	c.Type("html")
+	return c.SendString(a.renderDashboard(c, "", l.H("members.invitation_sent", email)))
+}
+
+func (a *Auth) handleOrgInvitationRevoke(c *fiber.Ctx) error {
+	a.dbFor(c).Model(&OrgInvitation{}).
+		Where("id = ? AND organization_id = ? AND responded_at IS NULL", c.Params("id"), CurrentMembership(c).OrganizationID).
+		Update("responded_at", time.Now())
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// respondToOrgInvitation loads the open invitation :id addressed to the
+// current user. Accounts that never confirmed their address, such as ones
+// made before confirmation was required, can't respond until they sign in
+// with an emailed link: anyone could have registered the address.
+func (a *Auth) respondToOrgInvitation(c *fiber.Ctx) (*OrgInvitation, error) {
+	user := CurrentUser(c)
+	if user.EmailNormalized == nil {
+		return nil, fiber.ErrNotFound
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, fiber.ErrForbidden
+	}
+
+	var inv OrgInvitation
+	err := a.dbFor(c).Joins("Organization").
+		Where("org_invitations.id = ? AND org_invitations.email_normalized = ? AND org_invitations.responded_at IS NULL AND org_invitations.expires_at > ?",
+			c.Params("id"), *user.EmailNormalized, time.Now()).
+		First(&inv).Error
+	if err != nil {
+		return nil, fiber.ErrNotFound
+	}
+	return &inv, nil
+}
+
+func (a *Auth) handleOrgInvitationAccept(c *fiber.Ctx) error {
+	user := CurrentUser(c)
+	inv, err := a.respondToOrgInvitation(c)
+	if err != nil {
+		return err
+	}
+
+	err = a.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(inv).Update("responded_at", time.Now()).Error; err != nil {
+			return err
+		}
+		var existing int64
+		tx.Model(&Membership{}).Where("organization_id = ? AND user_id = ?", inv.OrganizationID, user.ID).Count(&existing)
+		if existing > 0 {
+			return nil
+		}
+		return tx.Create(&Membership{OrganizationID: inv.OrganizationID, UserID: user.ID, Role: inv.Role}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	sess, err := a.loadSession(c)
+	if err != nil {
+		return err
+	}
+	sess.Set("orgID", inv.OrganizationID)
+	if err := a.saveSession(c, sess); err != nil {
+		return err
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleOrgInvitationDecline(c *fiber.Ctx) error {
+	inv, err := a.respondToOrgInvitation(c)
+	if err != nil {
+		return err
+	}
+	a.dbFor(c).Model(inv).Update("responded_at", time.Now())
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleMemberRole(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	current := CurrentMembership(c)
+	member, err := a.findMember(current.OrganizationID, c.Params("userID"))
+	if err != nil {
+		return err
+	}
+
+	role := c.FormValue("role")
+	if role != orgRoleAdmin && role != orgRoleMember {
+		return fiber.ErrBadRequest
+	}
+	if member.Role == orgRoleOwner {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("members.owner_role"), ""))
+	}
+
+	a.dbFor(c).Model(member).Update("role", role)
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleMemberRemove(c *fiber.Ctx) error {
+	current := CurrentMembership(c)
+	member, err := a.findMember(current.OrganizationID, c.Params("userID"))
+	if err != nil {
+		return err
+	}
+
+	// Owners can remove anyone else; admins can only remove members.
+	if member.Role == orgRoleOwner || member.UserID == current.UserID ||
+		(current.Role == orgRoleAdmin && member.Role != orgRoleMember) {
+		return fiber.ErrForbidden
+	}
+
+	a.dbFor(c).Delete(member)
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleWorkspaceLeave(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	current := CurrentMembership(c)
+	if current.Organization.Personal {
+		return fiber.ErrForbidden
+	}
+	if current.Role == orgRoleOwner {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("members.owner_leave"), ""))
+	}
+
+	a.dbFor(c).Delete(current)
+	sess, err := a.loadSession(c)
+	if err != nil {
+		return err
+	}
+	sess.Delete("orgID")
+	if err := a.saveSession(c, sess); err != nil {
+		return err
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleOwnershipTransfer(c *fiber.Ctx) error {
+	current := CurrentMembership(c)
+	if current.Organization.Personal {
+		return fiber.ErrForbidden
+	}
+
+	member, err := a.findMember(current.OrganizationID, c.FormValue("user_id"))
+	if err != nil {
+		return err
+	}
+	if member.UserID == current.UserID {
+		return c.Redirect(a.path("/dashboard"))
+	}
+
+	err = a.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(member).Update("role", orgRoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(current).Update("role", orgRoleAdmin).Error
+	})
+	if err != nil {
+		return err
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// renderMembersPanel lists the current workspace's members and pending
+// invitations with the management actions current's role allows.
+func (a *Auth) renderMembersPanel(l *localizer, current *Membership) string {
+	if current.Organization.Personal {
+		return ""
+	}
+
+	var members []Membership
+	a.db.Where("organization_id = ?", current.OrganizationID).Order("created_at").Find(&members)
+	emails := map[uint]string{}
+	var users []User
+	a.db.Select("id", "email").Where("id IN (?)", a.db.Model(&Membership{}).Select("user_id").Where("organization_id = ?", current.OrganizationID)).Find(&users)
+	for _, u := range users {
+		emails[u.ID] = u.Email
+	}
+
+	isOwner := current.Role == orgRoleOwner
+	isManager := isOwner || current.Role == orgRoleAdmin
+
+	var rows strings.Builder
+	for _, m := range members {
+		actions := ""
+		if isOwner && m.Role != orgRoleOwner {
+			other := orgRoleAdmin
+			if m.Role == orgRoleAdmin {
+				other = orgRoleMember
+			}
+			actions += fmt.Sprintf(`<form method="POST" action="%s/workspace/members/%d/role" class="inline-form"><input type="hidden" name="role" value="%s"><button type="submit" class="account-btn">%s</button></form> `, a.basePath, m.UserID, other, l.H("members.make_"+other))
+			actions += fmt.Sprintf(`<form method="POST" action="%s" class="inline-form" data-confirm="%s"><input type="hidden" name="user_id" value="%d"><button type="submit" class="account-btn">%s</button></form> `, a.path("/workspace/transfer"), l.H("members.transfer_confirm"), m.UserID, l.H("members.make_owner"))
+		}
+		if m.UserID != current.UserID && m.Role != orgRoleOwner && (isOwner || (isManager && m.Role == orgRoleMember)) {
+			actions += fmt.Sprintf(`<form method="POST" action="%s/workspace/members/%d/remove" class="inline-form"><button type="submit" class="danger-btn">%s</button></form>`, a.basePath, m.UserID, l.H("members.remove"))
+		}
+		fmt.Fprintf(&rows, `<tr><td>%s</td><td>%s</td><td>%s</td></tr>`, html.EscapeString(emails[m.UserID]), l.H("role."+m.Role), actions)
+	}
+
+	inviteHTML := ""
+	if isManager {
+		var pending []OrgInvitation
+		a.db.Where("organization_id = ? AND responded_at IS NULL AND expires_at > ?", current.OrganizationID, time.Now()).Order("created_at").Find(&pending)
+		for _, inv := range pending {
+			fmt.Fprintf(&rows, `<tr><td>%s</td><td>%s</td><td><form method="POST" action="%s/workspace/invitations/%d/revoke" class="bare-form"><button type="submit" class="danger-btn">%s</button></form></td></tr>`,
+				html.EscapeString(inv.Email), l.H("members.invited", l.T("role."+inv.Role)), a.basePath, inv.ID, l.H("members.revoke"))
+		}
+
+		roleSelect := ""
+		if isOwner {
+			roleSelect = l.Page(`<select name="role"><option value="member">{{role.member}}</option><option value="admin">{{role.admin}}</option></select>`)
+		}
+		inviteHTML = fmt.Sprintf(l.Page(`<form method="POST" action="%s" class="account-row">
+                <input type="email" name="email" placeholder="colleague@example.com" required>
+                %s
+                <button type="submit" class="account-btn">{{members.invite}}</button>
+            </form>`), a.path("/workspace/invitations"), roleSelect)
+	}
+
+	leaveHTML := ""
+	if !isOwner {
+		leaveHTML = fmt.Sprintf(l.Page(`<form method="POST" action="%s" class="account-row"><button type="submit" class="danger-btn">{{members.leave}}</button></form>`), a.path("/workspace/leave"))
+	}
+
+	return fmt.Sprintf(l.Page(`<section class="account-panel">
+            <h3>{{members.title}}</h3>
+            %s
+            <table class="account-table"><tr><th>{{field.email}}</th><th>{{members.role}}</th><th></th></tr>%s</table>
+            %s
+        </section>`), inviteHTML, rows.String(), leaveHTML)
+}
+
+// renderOrgInvitationsPanel lists workspace invitations waiting for user.
+func (a *Auth) renderOrgInvitationsPanel(l *localizer, user *User) string {
+	if user.EmailNormalized == nil {
+		return ""
+	}
+	invitations := a.pendingOrgInvitations(*user.EmailNormalized)
+	if len(invitations) == 0 {
+		return ""
+	}
+
+	var rows strings.Builder
+	if user.EmailVerifiedAt == nil {
+		rows.WriteString(`<p class="empty-text">` + l.H("org_invitations.verify_email") + `</p>`)
+	}
+	for _, inv := range invitations {
+		if user.EmailVerifiedAt == nil {
+			fmt.Fprintf(&rows, `<div class="account-row centered"><span class="grow">%s</span></div>`,
+				fmt.Sprintf(l.H("org_invitations.join"), "<strong>"+html.EscapeString(inv.Organization.Name)+"</strong>", l.H("role."+inv.Role)))
+			continue
+		}
+		fmt.Fprintf(&rows, `<div class="account-row centered">
+                <span class="grow">%s</span>
+                <form method="POST" action="%s/workspace-invitations/%d/accept" class="bare-form"><button type="submit" class="account-btn">%s</button></form>
+                <form method="POST" action="%s/workspace-invitations/%d/decline" class="bare-form"><button type="submit" class="danger-btn">%s</button></form>
+            </div>`, fmt.Sprintf(l.H("org_invitations.join"), "<strong>"+html.EscapeString(inv.Organization.Name)+"</strong>", l.H("role."+inv.Role)),
+			a.basePath, inv.ID, l.H("org_invitations.accept"), a.basePath, inv.ID, l.H("org_invitations.decline"))
+	}
+	return `<section class="account-panel">
+            <h3>` + l.H("org_invitations.title") + `</h3>
+            ` + rows.String() + `
+        </section>`
+}
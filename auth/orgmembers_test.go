@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var workspaceInviteLink = regexp.MustCompile(`/register\?workspace_invite=\S+`)
+
+// inviteToWorkspace has a new workspace owned by owner invite email, and
+// returns the invitation.
+func (e *testEnv) inviteToWorkspace(t *testing.T, owner *testClient, email string) *OrgInvitation {
+	t.Helper()
+	if resp, _ := owner.post("/workspaces", url.Values{"name": {"Acme"}}); resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("creating a workspace: status %d", resp.StatusCode)
+	}
+	if resp, _ := owner.post("/workspace/invitations", url.Values{"email": {email}}); resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("inviting %s: status %d", email, resp.StatusCode)
+	}
+	var inv OrgInvitation
+	if err := e.auth.db.Where("email = ? AND responded_at IS NULL", email).First(&inv).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &inv
+}
+
+func (e *testEnv) isMember(orgID, userID uint) bool {
+	var n int64
+	e.auth.db.Model(&Membership{}).Where("organization_id = ? AND user_id = ?", orgID, userID).Count(&n)
+	return n > 0
+}
+
+func TestOrgInvitationNeedsConfirmedEmail(t *testing.T) {
+	e := newTestEnv(t)
+	owner := e.client(t)
+	e.createUser(t, "owner@example.com", testPassword, true)
+	owner.login("owner@example.com", testPassword)
+
+	// An account for the invited address that never proved it reads its
+	// mail, as anyone could have made before confirmation was required.
+	squatter := e.createUser(t, "invitee@example.com", testPassword, false)
+	inv := e.inviteToWorkspace(t, owner, "invitee@example.com")
+	accept := "/workspace-invitations/" + fmt.Sprint(inv.ID) + "/accept"
+
+	c := e.client(t)
+	if !c.login("invitee@example.com", testPassword) {
+		t.Fatal("login failed")
+	}
+	if _, page := c.get("/dashboard"); !strings.Contains(page, englishLocalizer().H("org_invitations.verify_email")) || strings.Contains(page, accept) {
+		t.Error("an unconfirmed account is offered to accept the invitation")
+	}
+	if resp, _ := c.post(accept, url.Values{}); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("accepting unconfirmed: status %d, want 403", resp.StatusCode)
+	}
+	if e.isMember(inv.OrganizationID, squatter.ID) {
+		t.Fatal("an unconfirmed account joined the workspace")
+	}
+
+	// Signing in with an emailed link confirms the address.
+	c.post("/logout", url.Values{})
+	c.post("/login/magic", url.Values{"identifier": {"invitee@example.com"}})
+	if resp, _ := c.get(linkIn(t, e.waitForMail(t, "invitee@example.com", 2))); resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("magic link: status %d", resp.StatusCode)
+	}
+	if resp, _ := c.post(accept, url.Values{}); resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("accepting confirmed: status %d", resp.StatusCode)
+	}
+	if !e.isMember(inv.OrganizationID, squatter.ID) {
+		t.Error("a confirmed account could not join the workspace")
+	}
+}
+
+func TestInviteOnlyRegistrationFromWorkspaceInvitation(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) { cfg.RegistrationMode = registrationInviteOnly })
+	owner := e.client(t)
+	e.createUser(t, "owner@example.com", testPassword, true)
+	owner.login("owner@example.com", testPassword)
+	inv := e.inviteToWorkspace(t, owner, "invitee@example.com")
+	link := workspaceInviteLink.FindString(e.waitForMail(t, "invitee@example.com", 1).Body)
+	if link == "" {
+		t.Fatal("the invitation mail has no registration link")
+	}
+	token, _ := url.ParseQuery(strings.TrimPrefix(link, "/register?"))
+
+	c := e.client(t)
+	_, page := c.get(link)
+	if strings.Contains(page, `name="invite_code"`) || !strings.Contains(page, `value="invitee@example.com" readonly`) {
+		t.Fatal("the registration form from an invitation still asks for a code")
+	}
+
+	// Without the link, or for another address, invite-only still holds.
+	c.register("invitee@example.com", testPassword, nil)
+	c.register("other@example.com", testPassword, token)
+	if e.mailCount("invitee@example.com") != 1 || e.mailCount("other@example.com") != 0 {
+		t.Fatal("registered without a usable invitation")
+	}
+
+	c.register("invitee@example.com", testPassword, token)
+	confirm := linkIn(t, e.waitForMail(t, "invitee@example.com", 2))
+	resp, _ := c.post(confirm, url.Values{"identifier": {"invitee@example.com"}, "password": {testPassword}})
+	if resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("confirming: status %d", resp.StatusCode)
+	}
+	var user User
+	e.auth.db.Where("email = ?", "invitee@example.com").First(&user)
+	if resp, _ := c.post("/workspace-invitations/"+fmt.Sprint(inv.ID)+"/accept", url.Values{}); resp.StatusCode != fiber.StatusFound || !e.isMember(inv.OrganizationID, user.ID) {
+		t.Errorf("accepting after registering: status %d", resp.StatusCode)
+	}
+}
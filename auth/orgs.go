@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"gorm.io/gorm"
+)
+
+// Roles a user can hold within an organization.
+const (
+	orgRoleOwner  = "owner"
+	orgRoleAdmin  = "admin"
+	orgRoleMember = "member"
+)
+
+// Organization is a workspace shared by its members. Every user gets a
+// personal one when they register.
+type Organization struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Personal  bool      `gorm:"not null;default:false" json:"personal"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// Membership gives a user a role in an organization.
+type Membership struct {
+	ID             uint         `gorm:"primaryKey" json:"-"`
+	OrganizationID uint         `gorm:"uniqueIndex:idx_membership;not null" json:"organization_id"`
+	UserID         uint         `gorm:"uniqueIndex:idx_membership;index;not null" json:"-"`
+	Role           string       `gorm:"size:32;not null" json:"role"`
+	CreatedAt      time.Time    `gorm:"autoCreateTime" json:"created_at"`
+	Organization   Organization `json:"organization"`
+}
+
+// createPersonalWorkspace creates user's personal organization inside tx
+// and makes them its owner.
+func createPersonalWorkspace(tx *gorm.DB, user *User) error {
+	org := Organization{Name: personalWorkspaceName(user.Email), Personal: true}
+	if err := tx.Create(&org).Error; err != nil {
+		return err
+	}
+	return tx.Create(&Membership{OrganizationID: org.ID, UserID: user.ID, Role: orgRoleOwner}).Error
+}
+
+func personalWorkspaceName(email string) string {
+	local, _, _ := strings.Cut(email, "@")
+	return truncate(local, 80) + "'s Workspace"
+}
+
+// ensurePersonalWorkspaces gives every user without any membership a
+// personal workspace, for accounts created before organizations existed.
+func (a *Auth) ensurePersonalWorkspaces() {
+	var users []User
+	a.db.Where("id NOT IN (?)", a.db.Model(&Membership{}).Select("user_id")).Find(&users)
+	for i := range users {
+		if err := a.db.Transaction(func(tx *gorm.DB) error { return createPersonalWorkspace(tx, &users[i]) }); err != nil {
+			a.logger.Warn("Failed to create personal workspace", "user_id", users[i].ID, "error", err)
+		}
+	}
+	if len(users) > 0 {
+		a.logger.Info("Created personal workspaces", "users", len(users))
+	}
+}
+
+// userMemberships returns every membership of userID with its
+// organization, personal workspace first.
+func (a *Auth) userMemberships(userID uint) []Membership {
+	var memberships []Membership
+	a.db.Joins("Organization").Where("memberships.user_id = ?", userID).Find(&memberships)
+	sort.SliceStable(memberships, func(i, j int) bool {
+		a, b := memberships[i].Organization, memberships[j].Organization
+		if a.Personal != b.Personal {
+			return a.Personal
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return memberships
+}
+
+// loadCurrentMembership resolves the organization selected in sess for
+// user, falling back to their first workspace when the selection is
+// missing or they are no longer a member.
+func (a *Auth) loadCurrentMembership(ctx context.Context, sess *session.Session, userID uint) (*Membership, error) {
+	var m Membership
+	if orgID, ok := sess.Get("orgID").(uint); ok {
+		err := a.db.WithContext(ctx).Joins("Organization").Where("memberships.user_id = ? AND memberships.organization_id = ?", userID, orgID).First(&m).Error
+		if err == nil {
+			return &m, nil
+		}
+	}
+	memberships := a.userMemberships(userID)
+	if len(memberships) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &memberships[0], nil
+}
+
+// orgRoleRequired only lets members holding one of roles in the current
+// organization through. It must run after RequireAuth.
+func orgRoleRequired(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		m := CurrentMembership(c)
+		for _, r := range roles {
+			if m.Role == r {
+				return c.Next()
+			}
+		}
+		return fiber.ErrForbidden
+	}
+}
+
+func (a *Auth) handleWorkspaceSwitch(c *fiber.Ctx) error {
+	user := CurrentUser(c)
+	orgID, err := c.ParamsInt("id")
+	if err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	var count int64
+	a.dbFor(c).Model(&Membership{}).Where("user_id = ? AND organization_id = ?", user.ID, orgID).Count(&count)
+	if count == 0 {
+		return fiber.ErrForbidden
+	}
+
+	sess, err := a.loadSession(c)
+	if err != nil {
+		return err
+	}
+	sess.Set("orgID", uint(orgID))
+	if err := a.saveSession(c, sess); err != nil {
+		return err
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleWorkspaceCreate(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	user := CurrentUser(c)
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("workspace.invalid_name"), ""))
+	}
+
+	org := Organization{Name: name}
+	err := a.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&Membership{OrganizationID: org.ID, UserID: user.ID, Role: orgRoleOwner}).Error
+	})
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("workspace.create_failed"), ""))
+	}
+
+	sess, err := a.loadSession(c)
+	if err != nil {
+		return err
+	}
+	sess.Set("orgID", org.ID)
+	if err := a.saveSession(c, sess); err != nil {
+		return err
+	}
+	return c.Redirect(a.path("/dashboard"))
+}
+
+func (a *Auth) handleWorkspaceRename(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	m := CurrentMembership(c)
+	name := strings.TrimSpace(c.FormValue("name"))
+	if name == "" || len(name) > 100 {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("workspace.invalid_name"), ""))
+	}
+	a.dbFor(c).Model(&Organization{}).Where("id = ?", m.OrganizationID).Update("name", name)
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// deleteUserMemberships removes userID from every organization inside tx,
+// deletes organizations left without members and hands ownership of the
+// rest to their longest-standing member when needed.
+func deleteUserMemberships(tx *gorm.DB, userID uint) error {
+	var orgIDs []uint
+	if err := tx.Model(&Membership{}).Where("user_id = ?", userID).Pluck("organization_id", &orgIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&Membership{}).Error; err != nil {
+		return err
+	}
+	for _, id := range orgIDs {
+		var remaining []Membership
+		tx.Where("organization_id = ?", id).Order("created_at").Find(&remaining)
+		if len(remaining) == 0 {
+			if err := tx.Where("organization_id = ?", id).Delete(&OrgInvitation{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&Organization{}, id).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Never leave a shared workspace without an owner.
+		hasOwner := false
+		for _, m := range remaining {
+			hasOwner = hasOwner || m.Role == orgRoleOwner
+		}
+		if !hasOwner {
+			if err := tx.Model(&remaining[0]).Update("role", orgRoleOwner).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderWorkspaceSwitcher renders the navbar dropdown listing user's
+// workspaces, with the current one selected.
+func (a *Auth) renderWorkspaceSwitcher(l *localizer, user *User, current *Membership) string {
+	var options strings.Builder
+	for _, m := range a.userMemberships(user.ID) {
+		selected := ""
+		if m.OrganizationID == current.OrganizationID {
+			selected = " selected"
+		}
+		fmt.Fprintf(&options, `<option value="%s/workspaces/%d/switch"%s>%s</option>`, a.basePath, m.OrganizationID, selected, html.EscapeString(m.Organization.Name))
+	}
+	return fmt.Sprintf(`<form method="POST" action="%s/workspaces/%d/switch" class="workspace-switcher" id="workspace-switcher">
+            <select aria-label="%s" data-autosubmit="action">%s</select>
+        </form>`, a.basePath, current.OrganizationID, l.H("workspace.title"), options.String())
+}
+
+// renderWorkspacePanel renders settings for the current workspace and a
+// form to create a new one.
+func (a *Auth) renderWorkspacePanel(l *localizer, current *Membership) string {
+	renameHTML := ""
+	if current.Role == orgRoleOwner || current.Role == orgRoleAdmin {
+		renameHTML = fmt.Sprintf(l.Page(`<form method="POST" action="%s" class="account-row">
+                <input type="text" name="name" value="%s" maxlength="100" required>
+                <button type="submit" class="account-btn">{{workspace.rename}}</button>
+            </form>`), a.path("/workspace/rename"), html.EscapeString(current.Organization.Name))
+	}
+
+	role := fmt.Sprintf(l.H("workspace.your_role"),
+		"<strong>"+l.H("role."+current.Role)+"</strong>", "<strong>"+html.EscapeString(current.Organization.Name)+"</strong>")
+	return fmt.Sprintf(l.Page(`<section class="account-panel">
+            <h3>{{workspace.title}}</h3>
+            <p>%s</p>
+            %s
+            <h3 class="section-gap">{{workspace.new}}</h3>
+            <form method="POST" action="%s" class="account-row">
+                <input type="text" name="name" placeholder="{{workspace.name}}" maxlength="100" required>
+                <button type="submit" class="account-btn">{{workspace.create}}</button>
+            </form>
+        </section>`), role, renameHTML, a.path("/workspaces"))
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWorkspaces(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.registerUser(t, e.client(t), "user@example.com", testPassword)
+	c := e.client(t)
+	c.login("user@example.com", testPassword)
+
+	var personal Membership
+	if err := e.auth.db.Joins("Organization").Where("memberships.user_id = ?", user.ID).First(&personal).Error; err != nil || !personal.Organization.Personal {
+		t.Fatal("registering didn't create a personal workspace")
+	}
+
+	if resp, _ := c.post("/workspaces", url.Values{"name": {"Acme"}}); resp.StatusCode != fiber.StatusFound {
+		t.Fatalf("creating a workspace: status %d", resp.StatusCode)
+	}
+	var acme Organization
+	e.auth.db.Where("name = ?", "Acme").First(&acme)
+	if !e.isMember(acme.ID, user.ID) {
+		t.Fatal("the creator isn't a member")
+	}
+	if resp, _ := c.post(fmt.Sprintf("/workspaces/%d/switch", personal.OrganizationID), nil); resp.StatusCode != fiber.StatusFound {
+		t.Errorf("switching workspaces: status %d", resp.StatusCode)
+	}
+
+	other := e.createUser(t, "other@example.com", testPassword, true)
+	var theirs Membership
+	e.auth.db.Where("user_id = ?", other.ID).First(&theirs)
+	if resp, _ := c.post(fmt.Sprintf("/workspaces/%d/switch", theirs.OrganizationID), nil); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("switching to someone else's workspace: status %d, want 403", resp.StatusCode)
+	}
+}
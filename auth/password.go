@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var errUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordHasher produces self-describing encoded password hashes and
+// verifies passwords against hashes in its own format.
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches encoded.
+	Verify(encoded, password string) (bool, error)
+	// Recognizes reports whether encoded is in this hasher's format.
+	Recognizes(encoded string) bool
+	// NeedsRehash reports whether encoded was produced with parameters
+	// other than the hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt at a fixed cost.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h BcryptHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// Argon2idHasher hashes passwords with argon2id and encodes them in the
+// PHC string format: $argon2id$v=19$m=<KiB>,t=<iterations>,p=<threads>$<salt>$<hash>.
+type Argon2idHasher struct {
+	Memory     uint32
+	Iterations uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+type argon2idHash struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Threads, h.KeyLength)
+
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(encoded, password string) (bool, error) {
+	parsed, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.iterations, parsed.memory, parsed.threads, uint32(len(parsed.key)))
+	return subtle.ConstantTimeCompare(key, parsed.key) == 1, nil
+}
+
+func (h Argon2idHasher) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	parsed, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return parsed.memory != h.Memory || parsed.iterations != h.Iterations || parsed.threads != h.Threads ||
+		uint32(len(parsed.salt)) != h.SaltLength || uint32(len(parsed.key)) != h.KeyLength
+}
+
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, errUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, err
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var parsed argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.iterations, &parsed.threads); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, err
+	}
+	if parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
+
+// hashPassword hashes password with the preferred hasher.
+func (a *Auth) hashPassword(ctx context.Context, password string) (string, error) {
+	h := a.hashers[0]
+	_, span := tracer.Start(ctx, "password.hash", trace.WithAttributes(attribute.String("password.algorithm", hasherName(h))))
+	defer span.End()
+	defer a.metrics.observePasswordHash(h, "hash", time.Now())
+	return h.Hash(password)
+}
+
+// verifyPassword checks password against encoded using whichever hasher
+// recognizes it, and reports whether the hash should be replaced with one
+// from the preferred hasher.
+func (a *Auth) verifyPassword(ctx context.Context, encoded, password string) (ok, needsRehash bool, err error) {
+	for i, h := range a.hashers {
+		if !h.Recognizes(encoded) {
+			continue
+		}
+		_, span := tracer.Start(ctx, "password.verify", trace.WithAttributes(attribute.String("password.algorithm", hasherName(h))))
+		start := time.Now()
+		ok, err = h.Verify(encoded, password)
+		a.metrics.observePasswordHash(h, "verify", start)
+		span.End()
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, i != 0 || h.NeedsRehash(encoded), nil
+	}
+	return false, false, errUnknownHashFormat
+}
+
+// dummyHashFor returns the hash to verify against when identifier matches
+// no account. Which hasher produced it is picked from the mix of formats
+// stored in the database, keyed on identifier so repeated attempts with
+// the same identifier always take the same time, like a real account's.
+func (a *Auth) dummyHashFor(identifier string) string {
+	shares := a.hasherShares.Load()
+	if shares == nil {
+		return a.dummyHashes[0]
+	}
+	mac := hmac.New(sha256.New, a.dummyKey)
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(identifier))))
+	u := float64(binary.BigEndian.Uint64(mac.Sum(nil))>>11) / (1 << 53)
+	for i, share := range *shares {
+		if u < share {
+			return a.dummyHashes[i]
+		}
+		u -= share
+	}
+	return a.dummyHashes[0]
+}
+
+// refreshHasherShares records the fraction of stored password hashes in
+// each hasher's format, for dummyHashFor.
+func (a *Auth) refreshHasherShares(ctx context.Context) {
+	counts := make([]float64, len(a.hashers))
+	total := 0.0
+	for i, h := range a.hashers {
+		prefix := hashPrefix(h)
+		if prefix == "" {
+			continue
+		}
+		var n int64
+		if err := a.db.WithContext(ctx).Model(&User{}).Where("password LIKE ?", prefix+"%").Count(&n).Error; err != nil {
+			return
+		}
+		counts[i] = float64(n)
+		total += float64(n)
+	}
+	if total == 0 {
+		return
+	}
+	for i := range counts {
+		counts[i] /= total
+	}
+	a.hasherShares.Store(&counts)
+}
+
+// hashPrefix returns the prefix every hash from h starts with.
+func hashPrefix(h PasswordHasher) string {
+	switch h.(type) {
+	case BcryptHasher:
+		return "$2"
+	case Argon2idHasher:
+		return "$argon2id$"
+	default:
+		return ""
+	}
+}
+
+// hasherName names h's algorithm for metrics and traces.
+func hasherName(h PasswordHasher) string {
+	switch h.(type) {
+	case BcryptHasher:
+		return "bcrypt"
+	case Argon2idHasher:
+		return "argon2id"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func englishLocalizer() *localizer {
+	return &localizer{locale: locales[0], tag: language.English}
+}
+
+func TestBcryptPolicyLimitsBytes(t *testing.T) {
+	// 40 runes, 80 bytes: within the rune limit but past bcrypt's 72 bytes.
+	password := strings.Repeat("é", 36) + "Zq7!"
+
+	for _, tc := range []struct {
+		algorithm string
+		wantLimit bool
+	}{
+		{"bcrypt", true},
+		{"argon2id", false},
+	} {
+		cfg := DefaultConfig()
+		cfg.PasswordHashAlgorithm = tc.algorithm
+		if err := cfg.validate(); err != nil {
+			t.Fatal(err)
+		}
+		l := englishLocalizer()
+		reasons := cfg.PasswordPolicy.check(l, password, "")
+		limit := l.N("policy.max_bytes", 72)
+		found := false
+		for _, r := range reasons {
+			found = found || r == limit
+		}
+		if found != tc.wantLimit {
+			t.Errorf("%s: byte limit reported = %v, want %v (reasons %q)", tc.algorithm, found, tc.wantLimit, reasons)
+		}
+	}
+}
+
+func TestDummyHashFollowsStoredHashMix(t *testing.T) {
+	a := &Auth{dummyHashes: []string{"argon2id", "bcrypt"}, dummyKey: []byte("key")}
+	if got := a.dummyHashFor("nobody@example.com"); got != "argon2id" {
+		t.Errorf("before counting, dummy hash = %q, want the preferred hasher's", got)
+	}
+
+	a.hasherShares.Store(&[]float64{0, 1})
+	if got := a.dummyHashFor("nobody@example.com"); got != "bcrypt" {
+		t.Errorf("with only bcrypt hashes stored, dummy hash = %q, want bcrypt", got)
+	}
+
+	a.hasherShares.Store(&[]float64{0.5, 0.5})
+	seen := map[string]int{}
+	for i := range 200 {
+		id := fmt.Sprintf("user%d@example.com", i)
+		first := a.dummyHashFor(id)
+		if again := a.dummyHashFor(" " + strings.ToUpper(id)); again != first {
+			t.Fatalf("%s: dummy hash changed between attempts: %q then %q", id, first, again)
+		}
+		seen[first]++
+	}
+	if seen["argon2id"] < 60 || seen["bcrypt"] < 60 {
+		t.Errorf("an even mix picked %v", seen)
+	}
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+	"gorm.io/gorm"
+)
+
+// Phone validation errors, worded for display to users.
+var (
+	errPhoneInvalid     = errors.New("Please enter a valid phone number")
+	errPhoneCountryCode = errors.New("Phone number has an unknown country code")
+	errPhoneTooShort    = errors.New("Phone number is too short")
+	errPhoneTooLong     = errors.New("Phone number is too long")
+)
+
+// maxPhoneLength is the width of the users.phone column.
+const maxPhoneLength = 40
+
+// normalizePhone parses raw, checks that its country code exists and its
+// length is possible for that country, and returns the international
+// display form together with the canonical E.164 form used for lookups and
+// uniqueness.
+func (a *Auth) normalizePhone(raw string) (display, e164 string, err error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", "", errPhoneInvalid
+	}
+
+	number, err := phonenumbers.Parse(raw, a.cfg.PhoneDefaultRegion)
+	if errors.Is(err, phonenumbers.ErrInvalidCountryCode) {
+		return "", "", errPhoneCountryCode
+	}
+	if err != nil {
+		return "", "", errPhoneInvalid
+	}
+
+	switch phonenumbers.IsPossibleNumberWithReason(number) {
+	case phonenumbers.IS_POSSIBLE:
+	case phonenumbers.INVALID_COUNTRY_CODE:
+		return "", "", errPhoneCountryCode
+	case phonenumbers.TOO_SHORT:
+		return "", "", errPhoneTooShort
+	case phonenumbers.TOO_LONG:
+		return "", "", errPhoneTooLong
+	default:
+		return "", "", errPhoneInvalid
+	}
+
+	// The display form keeps any extension, which E.164 drops.
+	display = phonenumbers.Format(number, phonenumbers.INTERNATIONAL)
+	if len(display) > maxPhoneLength {
+		return "", "", errPhoneTooLong
+	}
+	return display, phonenumbers.Format(number, phonenumbers.E164), nil
+}
+
+// formatPhone renders a stored number for display: in national format when
+// it belongs to Config.PhoneDefaultRegion, international format otherwise.
+// It is given the stored display form rather than E.164 so that any
+// extension is kept.
+func (a *Auth) formatPhone(phone string) string {
+	number, err := phonenumbers.Parse(phone, a.cfg.PhoneDefaultRegion)
+	if err != nil {
+		return phone
+	}
+	if phonenumbers.GetRegionCodeForNumber(number) == a.cfg.PhoneDefaultRegion {
+		return phonenumbers.Format(number, phonenumbers.NATIONAL)
+	}
+	return phonenumbers.Format(number, phonenumbers.INTERNATIONAL)
+}
+
+// findUserByIdentifier looks a user up by email, or by phone number when
+// identifier contains no "@".
+func (a *Auth) findUserByIdentifier(ctx context.Context, identifier string) (*User, error) {
+	if strings.Contains(identifier, "@") {
+		return a.findUserByEmail(ctx, identifier)
+	}
+
+	_, e164, err := a.normalizePhone(identifier)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var user User
+	if err := a.db.WithContext(ctx).Where("phone_e164 = ?", e164).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// backfillPhones fills phone_e164 for rows created before the column
+// existed and rewrites their display form. Invalid or duplicate numbers are
+// left untouched and logged.
+func (a *Auth) backfillPhones() {
+	var users []User
+	a.db.Where("phone <> '' AND phone IS NOT NULL AND phone_e164 IS NULL").Find(&users)
+	backfilled := 0
+	for _, u := range users {
+		display, e164, err := a.normalizePhone(u.Phone)
+		if err != nil {
+			a.logger.Warn("Invalid phone number, leaving it unnormalized", "user_id", u.ID)
+			continue
+		}
+
+		var other int64
+		a.db.Model(&User{}).Where("phone_e164 = ? AND id <> ?", e164, u.ID).Count(&other)
+		if other > 0 {
+			a.logger.Warn("Phone number already used by another account, leaving it unnormalized", "user_id", u.ID)
+			continue
+		}
+		a.db.Model(&u).Updates(map[string]interface{}{"phone": display, "phone_e164": e164})
+		backfilled++
+	}
+	if backfilled > 0 {
+		a.logger.Info("Backfilled E.164 phone numbers", "users", backfilled)
+	}
+}
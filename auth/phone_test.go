@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPhoneNumbersKeepTheirExtension(t *testing.T) {
+	e := newTestEnv(t)
+	user := e.createUser(t, "user@example.com", testPassword, true)
+	c := e.client(t)
+	c.login("user@example.com", testPassword)
+
+	// Longer than the column used to be once formatted.
+	c.post("/account/phone", url.Values{"phone": {"+44 20 7946 0958 ext. 123456"}})
+	e.auth.db.First(user, user.ID)
+	if want := "+44 20 7946 0958 ext. 123456"; user.Phone != want {
+		t.Errorf("stored phone = %q, want %q", user.Phone, want)
+	}
+	if user.PhoneE164 == nil || *user.PhoneE164 != "+442079460958" {
+		t.Errorf("stored E.164 = %v", user.PhoneE164)
+	}
+	if _, body := c.get("/dashboard"); !strings.Contains(body, `value="+44 20 7946 0958 ext. 123456"`) {
+		t.Error("the dashboard drops the extension")
+	}
+	if !e.client(t).login("+44 (0)20 7946 0958", testPassword) {
+		t.Error("the number doesn't sign in")
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	a := &Auth{cfg: DefaultConfig()}
+	for _, tc := range []struct {
+		raw, display, e164 string
+		err                error
+	}{
+		{"(555) 987-6543", "+1 555-987-6543", "+15559876543", nil},
+		{"+49 30 1234567", "+49 30 1234567", "+49301234567", nil},
+		{"+999 1234", "", "", errPhoneCountryCode},
+		{"12", "", "", errPhoneTooShort},
+		{"+1 555 987 6543 1234", "", "", errPhoneTooLong},
+		{"call me", "", "", errPhoneInvalid},
+	} {
+		display, e164, err := a.normalizePhone(tc.raw)
+		if display != tc.display || e164 != tc.e164 || err != tc.err {
+			t.Errorf("normalizePhone(%q) = %q, %q, %v; want %q, %q, %v", tc.raw, display, e164, err, tc.display, tc.e164, tc.err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"html"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// PasswordPolicy describes the rules every new password must satisfy. It is
+// served as JSON so the register page can evaluate it while the user types.
+type PasswordPolicy struct {
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+	// MaxBytes limits the UTF-8 encoded length, for hashers such as bcrypt
+	// that ignore input past a byte limit. Zero means no limit.
+	MaxBytes     int      `json:"max_bytes,omitempty"`
+	MinScore     int      `json:"min_score"`
+	BlockedTerms []string `json:"blocked_terms"`
+	CommonWords  []string `json:"common_words"`
+}
+
+// commonPasswordWords are fragments so common in real passwords that they
+// add almost nothing to a guesser's work.
+var commonPasswordWords = []string{
+	"password", "passw0rd", "qwerty", "azerty", "letmein", "welcome", "admin", "login",
+	"iloveyou", "monkey", "dragon", "master", "sunshine", "princess", "football",
+	"baseball", "shadow", "superman", "trustno1", "secret", "abc123", "123456",
+	"111111", "000000", "654321", "123123", "qazwsx", "zxcvbn", "asdfgh", "hello",
+}
+
+// check returns a reason, translated by l, for every rule password breaks.
+// email is treated as a blocked term along with its local part.
+func (p PasswordPolicy) check(l *localizer, password, email string) []string {
+	var reasons []string
+
+	length := len([]rune(password))
+	if length < p.MinLength {
+		reasons = append(reasons, l.N("policy.min_length", p.MinLength))
+	}
+	if length > p.MaxLength {
+		reasons = append(reasons, l.N("policy.max_length", p.MaxLength))
+	} else if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		reasons = append(reasons, l.N("policy.max_bytes", p.MaxBytes))
+	}
+
+	lower := strings.ToLower(password)
+	if email != "" {
+		local, _, _ := strings.Cut(strings.ToLower(email), "@")
+		if strings.Contains(lower, strings.ToLower(email)) || (utf8.RuneCountInString(local) >= 3 && strings.Contains(lower, local)) {
+			reasons = append(reasons, l.T("policy.contains_email"))
+		}
+	}
+	for _, term := range p.BlockedTerms {
+		if strings.Contains(lower, term) {
+			reasons = append(reasons, l.T("policy.contains_term", term))
+		}
+	}
+
+	if score := p.Score(password, email); score < p.MinScore {
+		reasons = append(reasons, l.T("policy.too_weak", score, p.MinScore))
+	}
+	return reasons
+}
+
+// Score rates password from 0 (trivial) to 4 (very strong) using the same
+// thresholds as zxcvbn, applied to an estimate of the guesses needed.
+// The register page runs an identical estimator in JavaScript.
+func (p PasswordPolicy) Score(password, email string) int {
+	bits := p.entropyBits(password, email)
+	switch {
+	case bits < 10: // < 10^3 guesses
+		return 0
+	case bits < 20: // < 10^6
+		return 1
+	case bits < 27: // < 10^8
+		return 2
+	case bits < 34: // < 10^10
+		return 3
+	default:
+		return 4
+	}
+}
+
+// entropyBits approximates log2 of the guesses needed for password.
+// Dictionary words, blocked terms and the user's own email are treated as a
+// single cheap token; repeated and sequential characters add one bit each;
+// anything else costs log2 of the character pool it was drawn from.
+func (p PasswordPolicy) entropyBits(password, email string) float64 {
+	lower := []rune(strings.ToLower(password))
+
+	tokens := append([]string{}, p.CommonWords...)
+	tokens = append(tokens, p.BlockedTerms...)
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); utf8.RuneCountInString(local) >= 3 {
+		tokens = append(tokens, local)
+	}
+
+	pool := 0.0
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if hasLower {
+		pool += 26
+	}
+	if hasUpper {
+		pool += 26
+	}
+	if hasDigit {
+		pool += 10
+	}
+	if hasSymbol {
+		pool += 33
+	}
+	if pool == 0 {
+		return 0
+	}
+	charBits := math.Log2(pool)
+
+	bits := 0.0
+	for i := 0; i < len(lower); {
+		if n := matchToken(lower[i:], tokens); n > 0 {
+			bits += math.Log2(float64(len(tokens)))
+			i += n
+			continue
+		}
+		if i > 0 && (lower[i] == lower[i-1] || lower[i] == lower[i-1]+1 || lower[i] == lower[i-1]-1) {
+			bits++
+		} else {
+			bits += charBits
+		}
+		i++
+	}
+	return bits
+}
+
+// matchToken returns the length of the longest token that s starts with.
+func matchToken(s []rune, tokens []string) int {
+	longest := 0
+	for _, t := range tokens {
+		t := []rune(t)
+		if len(t) > longest && len(t) <= len(s) && string(s[:len(t)]) == string(t) {
+			longest = len(t)
+		}
+	}
+	return longest
+}
+
+// validateNewPassword returns a user-facing reason for every problem with
+// password, or nil when it is acceptable.
+func (a *Auth) validateNewPassword(l *localizer, password, confirmPassword, email string) []string {
+	if password != confirmPassword {
+		return []string{l.T("policy.mismatch")}
+	}
+	if reasons := a.cfg.PasswordPolicy.check(l, password, email); len(reasons) > 0 {
+		return reasons
+	}
+	if a.isBreachedPassword(password) {
+		return []string{l.T("policy.breached")}
+	}
+	return nil
+}
+
+// reasonsHTML escapes reasons and joins them one per line.
+func reasonsHTML(reasons []string) string {
+	escaped := make([]string, len(reasons))
+	for i, r := range reasons {
+		escaped[i] = html.EscapeString(r)
+	}
+	return strings.Join(escaped, "<br>")
+}
+
+func (a *Auth) handlePasswordPolicy(c *fiber.Ctx) error {
+	return c.JSON(a.cfg.PasswordPolicy)
+}
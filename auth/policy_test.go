@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPasswordPolicyRules(t *testing.T) {
+	l := englishLocalizer()
+	policy := PasswordPolicy{MinLength: 10, MaxLength: 20, BlockedTerms: []string{"acme"}, CommonWords: commonPasswordWords}
+	withBytes := policy
+	withBytes.MaxBytes = 24
+	strict := policy
+	strict.MinScore = 3
+
+	for _, tc := range []struct {
+		name            string
+		policy          PasswordPolicy
+		password, email string
+		want            []string
+	}{
+		{"one under the minimum", policy, "Zq7!xk2#w", "", []string{l.N("policy.min_length", 10)}},
+		{"at the minimum", policy, "Zq7!xk2#wP", "", nil},
+		{"minimum counts runes", policy, "ééééééééé", "", []string{l.N("policy.min_length", 10)}},
+		{"at the maximum", policy, "Zq7!xk2#wPZq7!xk2#wP", "", nil},
+		{"one over the maximum", policy, "Zq7!xk2#wPZq7!xk2#wPx", "", []string{l.N("policy.max_length", 20)}},
+		{"within the byte limit", withBytes, "éééZq7!xk2#wP", "", nil},
+		{"over the byte limit", withBytes, "ééééééééééééééééééé", "", []string{l.N("policy.max_bytes", 24)}},
+		{"over both limits", withBytes, "éééééééééééééééééééééé", "", []string{l.N("policy.max_length", 20)}},
+		{"contains the email", policy, "Zq7!al@ex.io", "AL@EX.IO", []string{l.T("policy.contains_email")}},
+		{"contains the local part", policy, "Zq7!xALICEk2#", "alice@example.com", []string{l.T("policy.contains_email")}},
+		{"short local parts are allowed", policy, "Zq7!xalk2#wP", "al@example.com", nil},
+		{"contains a blocked term", policy, "Zq7!xACMEk2#", "", []string{l.T("policy.contains_term", "acme")}},
+		{"too weak", strict, "passwordpassword", "", []string{l.T("policy.too_weak", 0, 3)}},
+		{"strong enough", strict, "Violet-Tractor-93", "", nil},
+	} {
+		if got := tc.policy.check(l, tc.password, tc.email); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: check(%q) = %q, want %q", tc.name, tc.password, got, tc.want)
+		}
+	}
+}
+
+func TestPasswordScore(t *testing.T) {
+	policy := PasswordPolicy{BlockedTerms: []string{"acme"}, CommonWords: commonPasswordWords}
+	for _, tc := range []struct {
+		password, email string
+		want            int
+	}{
+		{"", "", 0},
+		{"password", "", 0},
+		{"qwerty123456", "", 0},
+		{"acmeacmeacme", "", 1},
+		{"abcdefghijkl", "", 1},
+		{"aaaaaaaaaaaaaaaaaaaa", "", 2},
+		{"kittens", "", 3},
+		{"alice2024alice", "alice@example.com", 3},
+		{"alice2024alice", "", 4},
+		{"Violet-Tractor-93-Lantern", "", 4},
+	} {
+		if got := policy.Score(tc.password, tc.email); got != tc.want {
+			t.Errorf("Score(%q, %q) = %d, want %d", tc.password, tc.email, got, tc.want)
+		}
+	}
+}
+
+func TestValidateLeavesBlockedTermsAlone(t *testing.T) {
+	terms := []string{"Acme", "GlassAuth"}
+	cfg := DefaultConfig()
+	cfg.PasswordPolicy.BlockedTerms = terms
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.PasswordPolicy.BlockedTerms, []string{"acme", "glassauth"}) {
+		t.Errorf("validated terms = %q", cfg.PasswordPolicy.BlockedTerms)
+	}
+	if !slices.Equal(terms, []string{"Acme", "GlassAuth"}) {
+		t.Errorf("the caller's terms became %q", terms)
+	}
+}
+
+func TestPasswordPolicyEndpoint(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) {
+		cfg.PasswordPolicy = PasswordPolicy{MinLength: 12, MaxLength: 64, MinScore: 3, BlockedTerms: []string{"Acme"}}
+	})
+	resp, body := e.client(t).get("/password-policy")
+	if resp.StatusCode != fiber.StatusOK || !strings.HasPrefix(resp.Header.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+	}
+
+	var got map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for k := range got {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if want := []string{"blocked_terms", "common_words", "max_length", "min_length", "min_score"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+
+	var policy PasswordPolicy
+	if err := json.Unmarshal([]byte(body), &policy); err != nil {
+		t.Fatal(err)
+	}
+	if policy.MinLength != 12 || policy.MaxLength != 64 || policy.MinScore != 3 || policy.MaxBytes != 0 {
+		t.Errorf("limits = %+v", policy)
+	}
+	if !slices.Equal(policy.BlockedTerms, []string{"acme"}) || !slices.Equal(policy.CommonWords, commonPasswordWords) {
+		t.Errorf("terms = %q, common words = %q", policy.BlockedTerms, policy.CommonWords)
+	}
+}
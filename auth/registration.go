@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// PendingRegistration holds a sign-up until its owner proves they read
+// mail for the address. The account is only created when the emailed link
+// is opened and the registrant signs in with the same email and password,
+// so registering someone else's address leads nowhere and a link opened by
+// a mail scanner activates nothing. Only the token hash is stored.
+type PendingRegistration struct {
+	ID              uint      `gorm:"primaryKey"`
+	TokenHash       string    `gorm:"uniqueIndex;size:64;not null"`
+	Email           string    `gorm:"size:255;not null"`
+	EmailNormalized string    `gorm:"index;size:255;not null"`
+	Password        string    `gorm:"not null"`
+	InvitationID    *uint     `gorm:"index"`
+	OrgInvitationID *uint     // let in by a workspace invitation while invite-only
+	ExpiresAt       time.Time `gorm:"index;not null"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+}
+
+var errRegistrationLink = errors.New("registration link is invalid or expired")
+
+// startRegistration stores a pending registration and mails its
+// confirmation link. Earlier pending registrations for the address stay
+// valid: each one is bound to the password it was made with.
+func (a *Auth) startRegistration(c *fiber.Ctx, email, normalizedEmail, hash string, invitation *Invitation, orgInvitation *OrgInvitation) error {
+	token := randomToken(32)
+	pending := PendingRegistration{
+		TokenHash:       hashToken(token),
+		Email:           email,
+		EmailNormalized: normalizedEmail,
+		Password:        hash,
+		ExpiresAt:       time.Now().Add(a.cfg.RegistrationLinkTTL),
+	}
+	if invitation != nil {
+		pending.InvitationID = &invitation.ID
+	}
+	if orgInvitation != nil {
+		pending.OrgInvitationID = &orgInvitation.ID
+	}
+	if err := a.dbFor(c).Create(&pending).Error; err != nil {
+		return err
+	}
+
+	ml := a.mailLocalizer(c, nil)
+	a.sendMail(Mail{
+		To:      email,
+		Subject: ml.T("mail.registration.subject", a.theme.ProductName),
+		Body:    ml.T("mail.registration.body", ml.Duration(a.cfg.RegistrationLinkTTL), a.url("/register/confirm?token="+url.QueryEscape(token))),
+	})
+	return nil
+}
+
+// findPendingRegistration returns the unexpired registration for token.
+func (a *Auth) findPendingRegistration(ctx context.Context, token string) (*PendingRegistration, error) {
+	var pending PendingRegistration
+	if err := a.db.WithContext(ctx).Where("token_hash = ?", hashToken(token)).First(&pending).Error; err != nil {
+		return nil, errRegistrationLink
+	}
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, errRegistrationLink
+	}
+	return &pending, nil
+}
+
+// confirmAction is the form action of the confirmation page for token.
+func (a *Auth) confirmAction(token string) string {
+	return a.path("/register/confirm") + "?token=" + url.QueryEscape(token)
+}
+
+func (a *Auth) handleRegisterConfirmPage(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	token := c.Query("token")
+	c.Type("html")
+	if _, err := a.findPendingRegistration(c.UserContext(), token); err != nil {
+		return c.SendString(a.renderLoginPage(c, l.H("register.link_invalid"), ""))
+	}
+	return c.SendString(a.renderLoginPageFor(c, a.confirmAction(token), "", l.H("register.confirm_prompt")))
+}
+
+// handleRegisterConfirm creates the account once the registrant signs in
+// from the emailed link with the address and password they registered.
+func (a *Auth) handleRegisterConfirm(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	token := c.Query("token")
+	password := c.FormValue("password")
+
+	pending, err := a.findPendingRegistration(c.UserContext(), token)
+	if err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("register.link_invalid"), ""))
+	}
+	_, normalized, err := a.normalizeEmail(c.FormValue("identifier"))
+	if ok, _, _ := a.verifyPassword(c.UserContext(), pending.Password, password); err != nil || normalized != pending.EmailNormalized || !ok {
+		a.metrics.loginFailuresTotal.WithLabelValues(loginFailureWrongPassword).Inc()
+		c.Type("html")
+		return c.SendString(a.renderLoginPageFor(c, a.confirmAction(token), l.H("login.invalid_credentials"), ""))
+	}
+
+	now := time.Now()
+	user := User{
+		Email:           pending.Email,
+		EmailNormalized: &pending.EmailNormalized,
+		EmailVerifiedAt: &now,
+		Password:        pending.Password,
+		Role:            roleUser,
+	}
+	// Hooks approved the address when the registration was submitted, but
+	// ask again: the account is only created now, possibly much later.
+	event := newHookEvent(c, ActionRegister, &user)
+	if err := a.before(c, event); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, html.EscapeString(err.Error()), ""))
+	}
+	err = a.dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if pending.InvitationID != nil {
+			var inv Invitation
+			if err := tx.First(&inv, *pending.InvitationID).Error; err != nil || !inv.Usable(now) {
+				return errInvalidInvite
+			}
+			if err := redeemInvitation(tx, &inv); err != nil {
+				return err
+			}
+			user.Role = inv.Role
+		}
+		if pending.OrgInvitationID != nil {
+			var open int64
+			tx.Model(&OrgInvitation{}).Where("id = ? AND responded_at IS NULL AND expires_at > ?", *pending.OrgInvitationID, now).Count(&open)
+			if open == 0 {
+				return errInvalidInvite
+			}
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := createPersonalWorkspace(tx, &user); err != nil {
+			return err
+		}
+		return tx.Where("email_normalized = ?", pending.EmailNormalized).Delete(&PendingRegistration{}).Error
+	})
+	if errors.Is(err, errInvalidInvite) {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, html.EscapeString(l.Err(err)), ""))
+	}
+	if err != nil {
+		// Most likely another link for the same address was used first.
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("register.link_invalid"), ""))
+	}
+	a.recordAuthEvent(c, user.ID, eventRegister)
+	a.metrics.registrationsTotal.Inc()
+	a.after(c.UserContext(), event)
+	ml := a.mailLocalizer(c, &user)
+	a.sendMail(Mail{
+		To:      user.Email,
+		Subject: ml.T("mail.welcome.subject", a.theme.ProductName),
+		Body:    ml.T("mail.welcome.body", a.url("/login")),
+	})
+
+	if err := a.signIn(c, &user); err != nil {
+		c.Type("html")
+		return c.SendString(a.renderLoginPage(c, l.H("login.failed"), ""))
+	}
+	a.recordAuthEvent(c, user.ID, eventLogin)
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// purgeExpiredRegistrations deletes registrations whose link has expired.
+func (a *Auth) purgeExpiredRegistrations(now time.Time) {
+	a.db.Where("expires_at <= ?", now).Delete(&PendingRegistration{})
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testPassword = "Violet-Tractor-93-Lantern"
+
+var nonceAttr = regexp.MustCompile(`nonce="[^"]*"`)
+
+// sameShape strips what legitimately differs between two responses: the
+// CSP nonce and the submitted address.
+func sameShape(body, email string) string {
+	return strings.ReplaceAll(nonceAttr.ReplaceAllString(body, `nonce=""`), email, "EMAIL")
+}
+
+func cookieNames(c *testClient) []string {
+	var names []string
+	for name := range c.cookies {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestRegisterRespondsAlikeForNewAndExistingEmails(t *testing.T) {
+	e := newTestEnv(t)
+	e.registerUser(t, e.client(t), "taken@example.com", testPassword)
+
+	newClient, oldClient := e.client(t), e.client(t)
+	newResp, newBody := newClient.register("fresh@example.com", testPassword, nil)
+	oldResp, oldBody := oldClient.register("taken@example.com", testPassword, nil)
+
+	if newResp.StatusCode != oldResp.StatusCode {
+		t.Errorf("status: new %d, existing %d", newResp.StatusCode, oldResp.StatusCode)
+	}
+	for _, h := range []string{fiber.HeaderContentType, fiber.HeaderLocation, fiber.HeaderXFrameOptions} {
+		if newResp.Header.Get(h) != oldResp.Header.Get(h) {
+			t.Errorf("%s: new %q, existing %q", h, newResp.Header.Get(h), oldResp.Header.Get(h))
+		}
+	}
+	if n, o := cookieNames(newClient), cookieNames(oldClient); !slices.Equal(n, o) {
+		t.Errorf("cookies: new %v, existing %v", n, o)
+	}
+	if sameShape(newBody, "fresh@example.com") != sameShape(oldBody, "taken@example.com") {
+		t.Error("response bodies differ between a new and an existing email")
+	}
+
+	// Each address gets exactly one message, and neither submission
+	// leaves a usable account behind.
+	e.waitForMail(t, "fresh@example.com", 1)
+	e.waitForMail(t, "taken@example.com", 2)
+	if !e.client(t).login("taken@example.com", testPassword) {
+		t.Error("the existing account no longer signs in")
+	}
+	probe := e.client(t)
+	if probe.login("fresh@example.com", testPassword) {
+		t.Error("a new registration signs in before its email is confirmed")
+	}
+	_, wrong := e.client(t).post("/login", url.Values{"identifier": {"taken@example.com"}, "password": {"not-the-password"}})
+	_, unconfirmed := probe.post("/login", url.Values{"identifier": {"fresh@example.com"}, "password": {testPassword}})
+	if sameShape(wrong, "taken@example.com") != sameShape(unconfirmed, "fresh@example.com") {
+		t.Error("signing in to an unconfirmed registration differs from a wrong password")
+	}
+}
+
+func TestRegisterDoesTheSameWorkForNewAndExistingEmails(t *testing.T) {
+	e := newTestEnv(t)
+	e.registerUser(t, e.client(t), "taken@example.com", testPassword)
+	c := e.client(t)
+
+	hashes := func(email string) uint64 {
+		t.Helper()
+		before := e.passwordHashes(t, "hash")["argon2id"]
+		c.register(email, testPassword, nil)
+		return e.passwordHashes(t, "hash")["argon2id"] - before
+	}
+	if fresh, taken := hashes("fresh@example.com"), hashes("taken@example.com"); fresh != 1 || taken != 1 {
+		t.Errorf("passwords hashed: new email %d, existing email %d; want 1 for both", fresh, taken)
+	}
+}
+
+func TestRegisterTakesAsLongForNewAndExistingEmails(t *testing.T) {
+	requireTimingTests(t)
+	e := newTestEnv(t)
+	e.registerUser(t, e.client(t), "taken@example.com", testPassword)
+
+	const rounds = 9
+	var fresh, taken []time.Duration
+	c := e.client(t)
+	for i := range rounds {
+		start := time.Now()
+		c.register(fmt.Sprintf("fresh%d@example.com", i), testPassword, nil)
+		fresh = append(fresh, time.Since(start))
+
+		start = time.Now()
+		c.register("taken@example.com", testPassword, nil)
+		taken = append(taken, time.Since(start))
+	}
+	slices.Sort(fresh)
+	slices.Sort(taken)
+	f, k := fresh[rounds/2], taken[rounds/2]
+	if ratio := float64(f) / float64(k); ratio < 0.5 || ratio > 2 {
+		t.Errorf("median response time: new %v, existing %v", f, k)
+	}
+}
+
+func TestRegistrationActivatesFromEmailedLink(t *testing.T) {
+	e := newTestEnv(t)
+	c := e.client(t)
+	c.register("new@example.com", testPassword, nil)
+	link := linkIn(t, e.waitForMail(t, "new@example.com", 1))
+
+	resp, page := c.get(link)
+	if resp.StatusCode != fiber.StatusOK || !strings.Contains(page, `action="/register/confirm?token=`) {
+		t.Fatalf("confirmation page: status %d, no confirmation form", resp.StatusCode)
+	}
+
+	resp, _ = c.post(link, url.Values{"identifier": {"new@example.com"}, "password": {"wrong password"}})
+	if resp.StatusCode != fiber.StatusOK {
+		t.Errorf("wrong password: status %d, want the form again", resp.StatusCode)
+	}
+	var count int64
+	e.auth.db.Model(&User{}).Where("email = ?", "new@example.com").Count(&count)
+	if count != 0 {
+		t.Fatal("a wrong password created the account")
+	}
+
+	resp, _ = c.post(link, url.Values{"identifier": {"new@example.com"}, "password": {testPassword}})
+	if resp.StatusCode != fiber.StatusFound || resp.Header.Get(fiber.HeaderLocation) != "/dashboard" {
+		t.Fatalf("confirming: status %d to %q", resp.StatusCode, resp.Header.Get(fiber.HeaderLocation))
+	}
+	var user User
+	e.auth.db.Where("email = ?", "new@example.com").First(&user)
+	if user.EmailVerifiedAt == nil {
+		t.Error("confirmed account is not marked verified")
+	}
+	if resp, _ := c.get("/dashboard"); resp.StatusCode != fiber.StatusOK {
+		t.Errorf("dashboard after confirming: status %d", resp.StatusCode)
+	}
+
+	resp, page = e.client(t).post(link, url.Values{"identifier": {"new@example.com"}, "password": {testPassword}})
+	if !strings.Contains(page, englishLocalizer().H("register.link_invalid")) {
+		t.Errorf("reusing the link: status %d, not rejected", resp.StatusCode)
+	}
+}
+
+func TestRegistrationLinkIsBoundToItsPassword(t *testing.T) {
+	e := newTestEnv(t)
+	attacker, victim := e.client(t), e.client(t)
+
+	attacker.register("victim@example.com", "Attacker-Owned-Passw0rd-77", nil)
+	attackerLink := linkIn(t, e.waitForMail(t, "victim@example.com", 1))
+	victim.register("victim@example.com", testPassword, nil)
+	victimLink := linkIn(t, e.waitForMail(t, "victim@example.com", 2))
+
+	// The victim opens the attacker's link by mistake: their own password
+	// doesn't activate the attacker's registration.
+	if resp, _ := victim.post(attackerLink, url.Values{"identifier": {"victim@example.com"}, "password": {testPassword}}); resp.StatusCode == fiber.StatusFound {
+		t.Fatal("the attacker's registration was activated with the victim's password")
+	}
+	if resp, _ := victim.post(victimLink, url.Values{"identifier": {"victim@example.com"}, "password": {testPassword}}); resp.StatusCode != fiber.StatusFound {
+		t.Fatal("the victim's own link did not activate their account")
+	}
+	if attacker.login("victim@example.com", "Attacker-Owned-Passw0rd-77") {
+		t.Error("the attacker's password signs in to the victim's account")
+	}
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Color schemes. A user's empty preference follows the theme's default.
+const (
+	schemeDark   = "dark"
+	schemeLight  = "light"
+	schemeSystem = "system"
+)
+
+// Theme brands the rendered pages. Colors are #rrggbb; Background and
+// LightBackground are the stops of the page gradient in each scheme.
+type Theme struct {
+	ProductName     string   `json:"product_name"`
+	LogoURL         string   `json:"logo_url"`
+	Font            string   `json:"font"`
+	Primary         string   `json:"primary"`
+	Secondary       string   `json:"secondary"`
+	Accent          string   `json:"accent"`
+	Highlight       string   `json:"highlight"`
+	Background      []string `json:"background"`
+	LightBackground []string `json:"light_background"`
+	// Scheme is the default color scheme: "dark", "light" or "system" to
+	// follow the browser.
+	Scheme string `json:"scheme"`
+}
+
+// Themes are the built-in palettes, selectable with THEME.
+var Themes = map[string]Theme{
+	"aurora": {
+		Primary: "#8b5cf6", Secondary: "#3b82f6", Accent: "#ec4899", Highlight: "#10b981",
+		Background:      []string{"#0c0015", "#1a0a2e", "#16213e", "#0f3460", "#1a1a2e"},
+		LightBackground: []string{"#faf5ff", "#ede9fe", "#e0e7ff", "#dbeafe", "#f5f3ff"},
+	},
+	"ocean": {
+		Primary: "#0ea5e9", Secondary: "#06b6d4", Accent: "#6366f1", Highlight: "#14b8a6",
+		Background:      []string{"#020617", "#0c1a2e", "#0b2540", "#083344", "#0f172a"},
+		LightBackground: []string{"#f0f9ff", "#e0f2fe", "#cffafe", "#ccfbf1", "#f0fdfa"},
+	},
+	"sunset": {
+		Primary: "#f97316", Secondary: "#ef4444", Accent: "#ec4899", Highlight: "#eab308",
+		Background:      []string{"#140806", "#2a0f0a", "#3b1220", "#451a03", "#1c0a0a"},
+		LightBackground: []string{"#fff7ed", "#ffedd5", "#fee2e2", "#fce7f3", "#fffbeb"},
+	},
+	"forest": {
+		Primary: "#22c55e", Secondary: "#14b8a6", Accent: "#84cc16", Highlight: "#10b981",
+		Background:      []string{"#02100a", "#052e16", "#0b2a22", "#134e4a", "#0a1f14"},
+		LightBackground: []string{"#f0fdf4", "#dcfce7", "#ccfbf1", "#ecfccb", "#f7fee7"},
+	},
+}
+
+// ThemeFromEnv builds the theme from THEME (a built-in palette), then the
+// JSON file in THEME_FILE, then PRODUCT_NAME, LOGO_URL, THEME_FONT and
+// THEME_SCHEME.
+func ThemeFromEnv() (Theme, error) {
+	name := env.String("THEME", "aurora")
+	t, ok := Themes[name]
+	if !ok {
+		return Theme{}, fmt.Errorf("auth: unknown THEME %q", name)
+	}
+
+	if path := os.Getenv("THEME_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Theme{}, fmt.Errorf("auth: reading THEME_FILE: %w", err)
+		}
+		if err := json.Unmarshal(data, &t); err != nil {
+			return Theme{}, fmt.Errorf("auth: parsing THEME_FILE: %w", err)
+		}
+	}
+
+	t.ProductName = env.String("PRODUCT_NAME", t.ProductName)
+	t.LogoURL = env.String("LOGO_URL", t.LogoURL)
+	t.Font = env.String("THEME_FONT", t.Font)
+	t.Scheme = env.String("THEME_SCHEME", t.Scheme)
+	return t, t.validate()
+}
+
+var (
+	hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+	safeFont = regexp.MustCompile(`^[\w\s,'"-]+$`)
+)
+
+// validate fills unset fields from the default palette and rejects values
+// that can't be used in a stylesheet.
+func (t *Theme) validate() error {
+	def := Themes["aurora"]
+	if t.ProductName == "" {
+		t.ProductName = "3D Glass Auth"
+	}
+	if t.Font == "" {
+		t.Font = "'Segoe UI', system-ui, sans-serif"
+	}
+	if t.Scheme == "" {
+		t.Scheme = schemeDark
+	}
+	for _, c := range []struct {
+		v *string
+		d string
+	}{
+		{&t.Primary, def.Primary}, {&t.Secondary, def.Secondary}, {&t.Accent, def.Accent}, {&t.Highlight, def.Highlight},
+	} {
+		if *c.v == "" {
+			*c.v = c.d
+		}
+	}
+	if len(t.Background) == 0 {
+		t.Background = def.Background
+	}
+	if len(t.LightBackground) == 0 {
+		t.LightBackground = def.LightBackground
+	}
+
+	colors := append([]string{t.Primary, t.Secondary, t.Accent, t.Highlight}, t.Background...)
+	for _, c := range append(colors, t.LightBackground...) {
+		if !hexColor.MatchString(c) {
+			return fmt.Errorf("auth: theme color %q is not #rrggbb", c)
+		}
+	}
+	if !safeFont.MatchString(t.Font) {
+		return fmt.Errorf("auth: theme font %q contains unsupported characters", t.Font)
+	}
+	if t.Scheme != schemeDark && t.Scheme != schemeLight && t.Scheme != schemeSystem {
+		return fmt.Errorf("auth: theme scheme must be dark, light or system, got %q", t.Scheme)
+	}
+	return nil
+}
+
+// rgb is a color's channels.
+type rgb [3]float64
+
+func parseHex(s string) rgb {
+	n, _ := strconv.ParseUint(s[1:], 16, 32)
+	return rgb{float64(n >> 16 & 0xff), float64(n >> 8 & 0xff), float64(n & 0xff)}
+}
+
+// mix blends c towards o by t, from 0 (c) to 1 (o).
+func (c rgb) mix(o rgb, t float64) rgb {
+	for i := range c {
+		c[i] += (o[i] - c[i]) * t
+	}
+	return c
+}
+
+func (c rgb) hex() string {
+	return fmt.Sprintf("#%02x%02x%02x", int(c[0]+0.5), int(c[1]+0.5), int(c[2]+0.5))
+}
+
+// channels returns c as "r, g, b" for use in rgba().
+func (c rgb) channels() string {
+	return fmt.Sprintf("%d, %d, %d", int(c[0]+0.5), int(c[1]+0.5), int(c[2]+0.5))
+}
+
+var (
+	white = rgb{255, 255, 255}
+	black = rgb{0, 0, 0}
+)
+
+// cssVars returns the custom properties the page stylesheets use, for
+// scheme.
+func (t *Theme) cssVars(scheme string) string {
+	primary, secondary := parseHex(t.Primary), parseHex(t.Secondary)
+	accent, highlight := parseHex(t.Accent), parseHex(t.Highlight)
+
+	// Light tints read well on the dark background; the light scheme
+	// needs darker shades instead.
+	shade, fg, stops := white, "255, 255, 255", t.Background
+	surface, heading, danger := parseHex(t.Background[len(t.Background)/2]), "#ffffff", "#fca5a5"
+	if scheme == schemeLight {
+		shade, fg, stops = black, "15, 23, 42", t.LightBackground
+		surface, heading, danger = white, primary.mix(black, 0.6).hex(), "#b91c1c"
+	}
+
+	gradient := make([]string, len(stops))
+	for i, s := range stops {
+		pos := 0
+		if len(stops) > 1 {
+			pos = i * 100 / (len(stops) - 1)
+		}
+		gradient[i] = fmt.Sprintf("%s %d%%", s, pos)
+	}
+
+	vars := []string{
+		"color-scheme: " + scheme,
+		"--background: linear-gradient(135deg, " + strings.Join(gradient, ", ") + ")",
+		"--surface: " + surface.hex(),
+		"--font: " + t.Font,
+		"--fg: rgb(" + fg + ")",
+		"--fg-rgb: " + fg,
+		"--heading: " + heading,
+		"--danger: " + danger,
+		"--primary: " + primary.hex(),
+		"--primary-rgb: " + primary.channels(),
+		"--primary-light: " + primary.mix(shade, 0.25).hex(),
+		"--primary-lighter: " + primary.mix(shade, 0.5).hex(),
+		"--primary-blend: " + primary.mix(secondary, 0.5).hex(),
+		"--secondary: " + secondary.hex(),
+		"--secondary-rgb: " + secondary.channels(),
+		"--secondary-light: " + secondary.mix(shade, 0.25).hex(),
+		"--accent: " + accent.hex(),
+		"--accent-rgb: " + accent.channels(),
+		"--highlight: " + highlight.hex(),
+		"--highlight-rgb: " + highlight.channels(),
+		"--highlight-light: " + highlight.mix(shade, 0.25).hex(),
+		"--highlight-lighter: " + highlight.mix(shade, 0.5).hex(),
+		"--highlight-blend: " + highlight.mix(secondary, 0.5).hex(),
+	}
+	return strings.Join(vars, "; ") + ";"
+}
+
+// colorScheme returns the scheme for the request: the signed-in user's
+// preference, or the theme's default.
+func (a *Auth) colorScheme(c *fiber.Ctx) string {
+	if user := CurrentUser(c); user != nil && (user.ColorScheme == schemeLight || user.ColorScheme == schemeDark) {
+		return user.ColorScheme
+	}
+	return a.theme.Scheme
+}
+
+// themeStyle returns the stylesheet defining the theme's custom properties
+// for the request's color scheme.
+func (a *Auth) themeStyle(c *fiber.Ctx) string {
+	scheme, style := a.colorScheme(c), `<style nonce="`+CSPNonce(c)+`">`
+	if scheme != schemeSystem {
+		return style + ":root { " + a.theme.cssVars(scheme) + " }</style>"
+	}
+	return style + ":root { " + a.theme.cssVars(schemeDark) + " } " +
+		"@media (prefers-color-scheme: light) { :root { " + a.theme.cssVars(schemeLight) + " } }</style>"
+}
+
+// renderBrand renders the logo, if any, and the product name.
+func (a *Auth) renderBrand() string {
+	name := html.EscapeString(a.theme.ProductName)
+	if a.theme.LogoURL == "" {
+		return name
+	}
+	return fmt.Sprintf(`<img src="%s" alt="" class="brand-logo">%s`, html.EscapeString(a.theme.LogoURL), name)
+}
+
+func (a *Auth) handleAccountAppearance(c *fiber.Ctx) error {
+	scheme := c.FormValue("scheme")
+	if scheme != "" && scheme != schemeLight && scheme != schemeDark {
+		return fiber.ErrBadRequest
+	}
+	a.dbFor(c).Model(CurrentUser(c)).Update("color_scheme", scheme)
+	return c.Redirect(a.path("/dashboard"))
+}
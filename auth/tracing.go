@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"gorm.io/gorm"
+)
+
+// tracer creates the module's spans through the global tracer provider.
+var tracer = otel.Tracer("github.com/smart-developer1791/go-fiber-auth-3d/auth")
+
+// dbFor returns the database bound to the request's context, so queries
+// show up as spans of the request.
+func (a *Auth) dbFor(c *fiber.Ctx) *gorm.DB {
+	return a.db.WithContext(c.UserContext())
+}
+
+// loadSession loads the request's session inside a span.
+func (a *Auth) loadSession(c *fiber.Ctx) (*session.Session, error) {
+	_, span := tracer.Start(c.UserContext(), "session.load")
+	defer span.End()
+	sess, err := a.store.Get(c)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return sess, err
+}
+
+// saveSession saves sess inside a span.
+func (a *Auth) saveSession(c *fiber.Ctx, sess *session.Session) error {
+	_, span := tracer.Start(c.UserContext(), "session.save")
+	defer span.End()
+	if err := sess.Save(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"gorm.io/gorm"
+)
+
+// Delivery statuses. Dead deliveries ran out of attempts and stay in the
+// log until an admin retries them.
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryDead      = "dead"
+)
+
+// webhookTestEvent is sent by the test button, to that endpoint only.
+const webhookTestEvent = "webhook.test"
+
+// WebhookEndpoint receives auth events as signed JSON POSTs. Events is a
+// comma-separated list of event types; empty means all of them.
+type WebhookEndpoint struct {
+	ID          uint      `gorm:"primaryKey"`
+	URL         string    `gorm:"size:2048;not null"`
+	Secret      string    `gorm:"size:64;not null"`
+	Events      string    `gorm:"size:512"`
+	CreatedByID uint      `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+// Wants reports whether the endpoint subscribes to event.
+func (e *WebhookEndpoint) Wants(event string) bool {
+	if e.Events == "" {
+		return true
+	}
+	for _, s := range strings.Split(e.Events, ",") {
+		if s == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for one endpoint, with the outcome
+// of its latest attempt. Payload is signed again on every attempt.
+type WebhookDelivery struct {
+	ID             uint      `gorm:"primaryKey"`
+	EndpointID     uint      `gorm:"index;not null"`
+	UserID         *uint     `gorm:"index"` // whose event it is, nil for test pings
+	Event          string    `gorm:"size:64;not null"`
+	Payload        string    `gorm:"type:text;not null"`
+	Status         string    `gorm:"size:16;index;not null"`
+	Attempts       int       `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time `gorm:"index;not null"`
+	LastAttemptAt  *time.Time
+	ResponseStatus int
+	LastError      string    `gorm:"size:255"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+// webhookPayload is the JSON body of every delivery.
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      webhookData `json:"data"`
+}
+
+type webhookData struct {
+	UserID uint   `json:"user_id,omitempty"`
+	Email  string `json:"email,omitempty"`
+	IP     string `json:"ip,omitempty"`
+}
+
+// scrubWebhookDeliveries removes userID's email and IP from every payload
+// queued or sent for them, keeping the user ID so receivers can still match
+// the events to the account. Deliveries queued before they recorded their
+// user are found by payload.
+func scrubWebhookDeliveries(tx *gorm.DB, userID uint) error {
+	id := strconv.FormatUint(uint64(userID), 10)
+	var deliveries []WebhookDelivery
+	err := tx.Where("user_id = ? OR (user_id IS NULL AND (payload LIKE ? OR payload LIKE ?))",
+		userID, `%"user_id":`+id+`,%`, `%"user_id":`+id+`}%`).Find(&deliveries).Error
+	if err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		var payload webhookPayload
+		if json.Unmarshal([]byte(d.Payload), &payload) != nil || payload.Data.UserID != userID {
+			continue
+		}
+		payload.Data.Email, payload.Data.IP = "", ""
+		body, _ := json.Marshal(payload)
+		if err := tx.Model(&WebhookDelivery{}).Where("id = ?", d.ID).
+			Updates(map[string]interface{}{"payload": string(body), "user_id": userID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signWebhook returns the signature of body sent at timestamp: the hex
+// HMAC-SHA256 of "timestamp.body" keyed with secret.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff is how long to wait after the given number of failed
+// attempts.
+func (a *Auth) webhookBackoff(attempts int) time.Duration {
+	d := time.Duration(float64(a.cfg.WebhookRetryBase) * math.Pow(2, float64(attempts-1)))
+	if d <= 0 || d > a.cfg.WebhookRetryMax {
+		return a.cfg.WebhookRetryMax
+	}
+	return d
+}
+
+// queueWebhooks queues event for every endpoint subscribed to it.
+func (a *Auth) queueWebhooks(ctx context.Context, logger *slog.Logger, event string, userID uint, ip string) {
+	db := a.db.WithContext(ctx)
+	var endpoints []WebhookEndpoint
+	db.Find(&endpoints)
+
+	var deliveries []WebhookDelivery
+	var body []byte
+	for _, e := range endpoints {
+		if !e.Wants(event) {
+			continue
+		}
+		if body == nil {
+			data := webhookData{UserID: userID, IP: ip}
+			var user User
+			if db.Select("email").First(&user, userID).Error == nil {
+				data.Email = user.Email
+			}
+			body, _ = json.Marshal(webhookPayload{ID: utils.UUIDv4(), Type: event, CreatedAt: time.Now().UTC(), Data: data})
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			EndpointID:    e.ID,
+			UserID:        &userID,
+			Event:         event,
+			Payload:       string(body),
+			Status:        deliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+	if err := db.Create(&deliveries).Error; err != nil {
+		logger.Warn("Failed to queue webhooks", "event", event, "error", err)
+	}
+}
+
+// StartWebhooks delivers queued webhooks in a background goroutine,
+// checking for due deliveries every interval.
+func (a *Auth) StartWebhooks(interval time.Duration) {
+	go func() {
+		for {
+			a.deliverDueWebhooks(time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// deliverDueWebhooks attempts every pending delivery that is due.
+func (a *Auth) deliverDueWebhooks(now time.Time) {
+	var due []WebhookDelivery
+	a.db.Where("status = ? AND next_attempt_at <= ?", deliveryPending, now).Order("next_attempt_at").Limit(50).Find(&due)
+	for i := range due {
+		a.attemptDelivery(context.Background(), &due[i])
+	}
+}
+
+// attemptDelivery sends d once and records the outcome, scheduling a
+// retry or dead-lettering it on failure. It does nothing if another worker
+// claimed d first.
+func (a *Auth) attemptDelivery(ctx context.Context, d *WebhookDelivery) {
+	// Claim the delivery by bumping its attempt count, and push its next
+	// attempt past the request timeout in case this process dies mid-send.
+	now := time.Now()
+	claim := a.db.WithContext(ctx).Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", d.ID, deliveryPending, d.Attempts).
+		Updates(map[string]interface{}{"attempts": d.Attempts + 1, "next_attempt_at": now.Add(2 * a.cfg.WebhookTimeout), "last_attempt_at": now})
+	if claim.Error != nil || claim.RowsAffected != 1 {
+		return
+	}
+	d.Attempts++
+	d.LastAttemptAt = &now
+
+	var endpoint WebhookEndpoint
+	if err := a.db.WithContext(ctx).First(&endpoint, d.EndpointID).Error; err != nil {
+		a.db.WithContext(ctx).Model(d).Updates(map[string]interface{}{"status": deliveryDead, "last_error": "endpoint deleted"})
+		return
+	}
+
+	status, err := a.sendWebhook(ctx, &endpoint, d)
+	updates := map[string]interface{}{"response_status": status, "last_error": ""}
+	d.ResponseStatus = status
+	switch {
+	case err == nil:
+		updates["status"] = deliveryDelivered
+		d.Status = deliveryDelivered
+	case d.Attempts >= a.cfg.WebhookMaxAttempts:
+		updates["status"] = deliveryDead
+		updates["last_error"] = truncate(err.Error(), 255)
+		d.Status, d.LastError = deliveryDead, err.Error()
+		a.logger.Warn("Webhook dead-lettered", "delivery_id", d.ID, "endpoint_id", endpoint.ID, "attempts", d.Attempts, "error", err)
+	default:
+		updates["next_attempt_at"] = now.Add(a.webhookBackoff(d.Attempts))
+		updates["last_error"] = truncate(err.Error(), 255)
+		d.LastError = err.Error()
+	}
+	a.db.WithContext(ctx).Model(&WebhookDelivery{}).Where("id = ?", d.ID).Updates(updates)
+}
+
+// sendWebhook POSTs d's payload to endpoint and returns the response
+// status. Any status outside 2xx is an error.
+func (a *Auth) sendWebhook(ctx context.Context, endpoint *WebhookEndpoint, d *WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.WebhookTimeout)
+	defer cancel()
+
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "3D-Glass-Auth-Webhooks")
+	req.Header.Set("Webhook-Id", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("Webhook-Event", d.Event)
+	req.Header.Set("Webhook-Timestamp", timestamp)
+	req.Header.Set("Webhook-Signature", signWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := a.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// adminRequired only lets users with the admin role through. It must run
+// after RequireAuth.
+func adminRequired(c *fiber.Ctx) error {
+	if CurrentUser(c).Role != roleAdmin {
+		return fiber.ErrForbidden
+	}
+	return c.Next()
+}
+
+func (a *Auth) handleWebhookCreate(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	target, err := url.Parse(strings.TrimSpace(c.FormValue("url")))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("webhooks.invalid_url"), ""))
+	}
+
+	var events []string
+	for _, e := range strings.Split(c.FormValue("events"), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, e)
+		}
+	}
+
+	endpoint := WebhookEndpoint{
+		URL:         target.String(),
+		Secret:      "whsec_" + randomToken(24),
+		Events:      strings.Join(events, ","),
+		CreatedByID: CurrentUser(c).ID,
+	}
+	if err := a.dbFor(c).Create(&endpoint).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("webhooks.create_failed"), ""))
+	}
+
+	c.Type("html")
+	return c.SendString(a.renderDashboard(c, "", fmt.Sprintf(
+		l.H("webhooks.created"), "<code>"+endpoint.Secret+"</code>")))
+}
+
+func (a *Auth) handleWebhookDelete(c *fiber.Ctx) error {
+	var endpoint WebhookEndpoint
+	if err := a.dbFor(c).First(&endpoint, c.Params("id")).Error; err != nil {
+		return fiber.ErrNotFound
+	}
+	a.dbFor(c).Where("endpoint_id = ?", endpoint.ID).Delete(&WebhookDelivery{})
+	a.dbFor(c).Delete(&endpoint)
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// handleWebhookTest queues a test event for one endpoint and attempts it
+// right away so the result can be shown. Failures are retried like any
+// other delivery.
+func (a *Auth) handleWebhookTest(c *fiber.Ctx) error {
+	l := a.localizer(c)
+	var endpoint WebhookEndpoint
+	if err := a.dbFor(c).First(&endpoint, c.Params("id")).Error; err != nil {
+		return fiber.ErrNotFound
+	}
+
+	user := CurrentUser(c)
+	body, _ := json.Marshal(webhookPayload{
+		ID:        utils.UUIDv4(),
+		Type:      webhookTestEvent,
+		CreatedAt: time.Now().UTC(),
+		Data:      webhookData{UserID: user.ID, Email: user.Email, IP: c.IP()},
+	})
+	delivery := WebhookDelivery{
+		EndpointID:    endpoint.ID,
+		Event:         webhookTestEvent,
+		Payload:       string(body),
+		Status:        deliveryPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := a.dbFor(c).Create(&delivery).Error; err != nil {
+		c.Type("html")
+		return c.SendString(a.renderDashboard(c, l.H("webhooks.test_queue_failed"), ""))
+	}
+	a.attemptDelivery(c.UserContext(), &delivery)
+
+	c.Type("html")
+	if delivery.Status != deliveryDelivered {
+		return c.SendString(a.renderDashboard(c, l.H("webhooks.test_failed", delivery.LastError), ""))
+	}
+	return c.SendString(a.renderDashboard(c, "", l.H("webhooks.test_succeeded", delivery.ResponseStatus)))
+}
+
+// handleWebhookRetry puts a dead delivery back in the queue.
+func (a *Auth) handleWebhookRetry(c *fiber.Ctx) error {
+	a.dbFor(c).Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ?", c.Params("id"), deliveryDead).
+		Updates(map[string]interface{}{"status": deliveryPending, "attempts": 0, "next_attempt_at": time.Now()})
+	return c.Redirect(a.path("/dashboard"))
+}
+
+// renderWebhooksPanel lists webhook endpoints and recent deliveries for
+// admins.
+func (a *Auth) renderWebhooksPanel(l *localizer, user *User) string {
+	if user.Role != roleAdmin {
+		return ""
+	}
+
+	var endpoints []WebhookEndpoint
+	a.db.Order("created_at").Find(&endpoints)
+	urls := map[uint]string{}
+	var endpointRows strings.Builder
+	for _, e := range endpoints {
+		urls[e.ID] = e.URL
+		events := e.Events
+		if events == "" {
+			events = l.T("webhooks.all_events")
+		}
+		fmt.Fprintf(&endpointRows, `<tr><td>%s</td><td>%s</td><td><form method="POST" action="%s/admin/webhooks/%d/test" class="inline-form"><button type="submit" class="account-btn">%s</button></form> <form method="POST" action="%s/admin/webhooks/%d/delete" class="inline-form" data-confirm="%s"><button type="submit" class="danger-btn">%s</button></form></td></tr>`,
+			html.EscapeString(e.URL), html.EscapeString(events), a.basePath, e.ID, l.H("webhooks.send_test"), a.basePath, e.ID, l.H("webhooks.delete_confirm"), l.H("webhooks.delete"))
+	}
+	endpointTable := `<p class="empty-text">` + l.H("webhooks.none") + `</p>`
+	if endpointRows.Len() > 0 {
+		endpointTable = l.Page(`<table class="account-table"><tr><th>URL</th><th>{{webhooks.events}}</th><th></th></tr>`) + endpointRows.String() + `</table>`
+	}
+
+	var deliveries []WebhookDelivery
+	a.db.Order("created_at DESC").Limit(20).Find(&deliveries)
+	var deliveryRows strings.Builder
+	for _, d := range deliveries {
+		result := d.LastError
+		if d.ResponseStatus != 0 && result == "" {
+			result = fmt.Sprintf("HTTP %d", d.ResponseStatus)
+		}
+		action := ""
+		if d.Status == deliveryDead {
+			action = fmt.Sprintf(`<form method="POST" action="%s/admin/webhooks/deliveries/%d/retry" class="bare-form"><button type="submit" class="account-btn">%s</button></form>`, a.basePath, d.ID, l.H("webhooks.retry"))
+		}
+		fmt.Fprintf(&deliveryRows, `<tr><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td></tr>`,
+			d.CreatedAt.Format("Jan 2 15:04:05"), html.EscapeString(d.Event), html.EscapeString(urls[d.EndpointID]), d.Attempts, l.H("webhooks.status."+d.Status), html.EscapeString(result), action)
+	}
+	deliveryTable := `<p class="empty-text">` + l.H("webhooks.no_deliveries") + `</p>`
+	if deliveryRows.Len() > 0 {
+		deliveryTable = l.Page(`<table class="account-table"><tr><th>{{webhooks.queued}}</th><th>{{webhooks.event}}</th><th>{{webhooks.endpoint}}</th><th>{{webhooks.attempts}}</th><th>{{webhooks.status}}</th><th>{{webhooks.result}}</th><th></th></tr>`) + deliveryRows.String() + `</table>`
+	}
+
+	return fmt.Sprintf(l.Page(`<section class="account-panel">
+            <h3>{{webhooks.title}}</h3>
+            <form method="POST" action="%s" class="account-row">
+                <input type="url" name="url" placeholder="https://example.com/hooks/auth" required>
+                <input type="text" name="events" placeholder="{{webhooks.events_placeholder}}">
+                <button type="submit" class="account-btn">{{webhooks.add}}</button>
+            </form>
+            %s
+            <h3 class="section-gap">{{webhooks.recent}}</h3>
+            %s
+        </section>`), a.path("/admin/webhooks"), endpointTable, deliveryTable)
+}
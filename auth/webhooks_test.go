@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// webhookReceiver is an endpoint that answers with status and keeps the
+// requests it was sent.
+type webhookReceiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	r := &webhookReceiver{status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+		r.mu.Unlock()
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+func TestSignWebhook(t *testing.T) {
+	got := signWebhook("whsec_test", "1700000000", []byte(`{"id":"evt_1"}`))
+	if want := "v1=c89214b5b5da833daed6f0b8c5bb6bd58cea9022bd80ccc78230f3942d632925"; got != want {
+		t.Errorf("signWebhook = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	a := &Auth{cfg: DefaultConfig()}
+	a.cfg.WebhookRetryBase = 30 * time.Second
+	a.cfg.WebhookRetryMax = 6 * time.Hour
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{200, 6 * time.Hour},
+	} {
+		if got := a.webhookBackoff(tc.attempts); got != tc.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestFailingWebhooksAreRetriedThenDeadLettered(t *testing.T) {
+	e := newTestEnv(t, func(cfg *Config) { cfg.WebhookMaxAttempts = 3 })
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	endpoint := WebhookEndpoint{URL: receiver.URL, Secret: "whsec_test"}
+	e.auth.db.Create(&endpoint)
+	delivery := WebhookDelivery{EndpointID: endpoint.ID, Event: eventLogin, Payload: `{"id":"evt_1"}`, Status: deliveryPending, NextAttemptAt: time.Now()}
+	e.auth.db.Create(&delivery)
+
+	start := time.Now()
+	e.auth.attemptDelivery(context.Background(), &delivery)
+	var stored WebhookDelivery
+	e.auth.db.First(&stored, delivery.ID)
+	if stored.Status != deliveryPending || stored.Attempts != 1 || stored.ResponseStatus != http.StatusInternalServerError || stored.LastError != "HTTP 500" {
+		t.Fatalf("after one failure: status %q, %d attempts, HTTP %d, error %q", stored.Status, stored.Attempts, stored.ResponseStatus, stored.LastError)
+	}
+	if wait := stored.NextAttemptAt.Sub(start); wait < e.auth.cfg.WebhookRetryBase || wait > e.auth.cfg.WebhookRetryBase+time.Minute {
+		t.Errorf("next attempt in %v, want about %v", wait, e.auth.cfg.WebhookRetryBase)
+	}
+
+	// Nothing is due yet.
+	e.auth.deliverDueWebhooks(time.Now())
+	if n := len(receiver.received()); n != 1 {
+		t.Fatalf("%d attempts before the retry was due", n)
+	}
+	later := time.Now().Add(24 * time.Hour)
+	e.auth.deliverDueWebhooks(later)
+	e.auth.deliverDueWebhooks(later)
+	e.auth.deliverDueWebhooks(later)
+	e.auth.db.First(&stored, delivery.ID)
+	if stored.Status != deliveryDead || stored.Attempts != 3 {
+		t.Errorf("after running out of attempts: status %q, %d attempts", stored.Status, stored.Attempts)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 3 {
+		t.Fatalf("endpoint got %d requests, want 3", len(requests))
+	}
+	for _, r := range requests {
+		if string(r.body) != delivery.Payload {
+			t.Errorf("body = %s", r.body)
+		}
+		if got, want := r.header.Get("Webhook-Signature"), signWebhook("whsec_test", r.header.Get("Webhook-Timestamp"), r.body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if r.header.Get("Webhook-Event") != eventLogin || r.header.Get("Webhook-Id") != fmt.Sprint(delivery.ID) {
+			t.Errorf("event %q, id %q", r.header.Get("Webhook-Event"), r.header.Get("Webhook-Id"))
+		}
+	}
+}
+
+func TestWebhookTestSend(t *testing.T) {
+	e := newTestEnv(t)
+	admin := e.createUser(t, "admin@example.com", testPassword, true)
+	e.auth.db.Model(admin).Update("role", roleAdmin)
+	e.createUser(t, "user@example.com", testPassword, true)
+	c := e.client(t)
+	c.login("admin@example.com", testPassword)
+	l := englishLocalizer()
+
+	ok := newWebhookReceiver(t, http.StatusNoContent)
+	failing := newWebhookReceiver(t, http.StatusInternalServerError)
+	for _, r := range []*webhookReceiver{ok, failing} {
+		c.post("/admin/webhooks", url.Values{"url": {r.URL}, "events": {eventLogin}})
+	}
+	var endpoints []WebhookEndpoint
+	e.auth.db.Order("id").Find(&endpoints)
+	if len(endpoints) != 2 {
+		t.Fatalf("%d endpoints created, want 2", len(endpoints))
+	}
+
+	_, page := c.post(fmt.Sprintf("/admin/webhooks/%d/test", endpoints[0].ID), url.Values{})
+	if !strings.Contains(page, l.H("webhooks.test_succeeded", http.StatusNoContent)) {
+		t.Error("a successful test isn't reported")
+	}
+	requests := ok.received()
+	if len(requests) != 1 {
+		t.Fatalf("endpoint got %d requests, want 1", len(requests))
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(requests[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Type != webhookTestEvent || payload.Data.UserID != admin.ID {
+		t.Errorf("payload = %s", requests[0].body)
+	}
+	if got, want := requests[0].header.Get("Webhook-Signature"), signWebhook(endpoints[0].Secret, requests[0].header.Get("Webhook-Timestamp"), requests[0].body); got != want {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+
+	_, page = c.post(fmt.Sprintf("/admin/webhooks/%d/test", endpoints[1].ID), url.Values{})
+	if !strings.Contains(page, l.H("webhooks.test_failed", "HTTP 500")) {
+		t.Error("a failed test isn't reported")
+	}
+	var retry WebhookDelivery
+	e.auth.db.Where("endpoint_id = ?", endpoints[1].ID).First(&retry)
+	if retry.Status != deliveryPending || retry.Attempts != 1 {
+		t.Errorf("failed test: status %q, %d attempts, want it queued for a retry", retry.Status, retry.Attempts)
+	}
+
+	user := e.client(t)
+	user.login("user@example.com", testPassword)
+	if resp, _ := user.post(fmt.Sprintf("/admin/webhooks/%d/test", endpoints[0].ID), url.Values{}); resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("test send by a non-admin: status %d", resp.StatusCode)
+	}
+	if n := len(ok.received()); n != 1 {
+		t.Errorf("endpoint got %d requests, want 1", n)
+	}
+}
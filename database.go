@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// Supported values of DB_DRIVER.
+const (
+	driverSQLite   = "sqlite"
+	driverPostgres = "postgres"
+	driverMySQL    = "mysql"
+)
+
+// sqliteMemoryDSN is the DB_DSN that selects a throwaway in-memory SQLite
+// database.
+const sqliteMemoryDSN = ":memory:"
+
+// openDatabase connects to the database selected by DB_DRIVER and DB_DSN
+// (falling back to DATABASE_URL) and applies the pool settings.
+func openDatabase() (*gorm.DB, error) {
+	driver := env.String("DB_DRIVER", driverSQLite)
+	dsn := env.String("DB_DSN", os.Getenv("DATABASE_URL"))
+
+	var dialector gorm.Dialector
+	switch driver {
+	case driverSQLite:
+		if dsn == "" {
+			dsn = "auth.db"
+		}
+		dialector = sqlite.Open(dsn)
+	case driverPostgres:
+		if dsn == "" {
+			return nil, errors.New("DB_DSN is required for the postgres driver")
+		}
+		dialector = postgres.Open(dsn)
+	case driverMySQL:
+		if dsn == "" {
+			return nil, errors.New("DB_DSN is required for the mysql driver")
+		}
+		// Timestamps can only be scanned into time.Time with parseTime.
+		if !strings.Contains(dsn, "parseTime=") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&parseTime=true"
+			} else {
+				dsn += "?parseTime=true"
+			}
+		}
+		dialector = mysql.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q, want sqlite, postgres or mysql", driver)
+	}
+
+	conn, err := gorm.Open(dialector, &gorm.Config{Logger: gormLogger()})
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	if driver == driverSQLite && dsn == sqliteMemoryDSN {
+		// Every connection to :memory: opens its own empty database, so
+		// keep exactly one and never recycle it.
+		sqlDB.SetMaxOpenConns(1)
+		sqlDB.SetMaxIdleConns(1)
+		sqlDB.SetConnMaxLifetime(0)
+		sqlDB.SetConnMaxIdleTime(0)
+	} else {
+		sqlDB.SetMaxOpenConns(env.Int("DB_MAX_OPEN_CONNS", 0))
+		sqlDB.SetMaxIdleConns(env.Int("DB_MAX_IDLE_CONNS", 2))
+		sqlDB.SetConnMaxLifetime(env.Duration("DB_CONN_MAX_LIFETIME", 0))
+		sqlDB.SetConnMaxIdleTime(env.Duration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute))
+	}
+
+	logger.Info("Database connected", "driver", driver)
+	return conn, nil
+}
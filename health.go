@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// appReady is set once the database is migrated and seeded. Until then
+// only the health endpoints are served.
+var appReady atomic.Bool
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// startupGate answers 503 for everything but the health endpoints while
+// the app is starting.
+func startupGate(c *fiber.Ctx) error {
+	if appReady.Load() || c.Path() == "/healthz" || c.Path() == "/readyz" {
+		return c.Next()
+	}
+	c.Set(fiber.HeaderRetryAfter, "5")
+	return fiber.NewError(fiber.StatusServiceUnavailable, "Starting up, try again shortly")
+}
+
+// handleHealthz reports that the process is alive.
+func handleHealthz(c *fiber.Ctx) error {
+	return c.JSON(healthCheck{Status: "ok"})
+}
+
+// handleReadyz reports whether the app can serve logins: the database
+// answers, every table exists and the session storage works.
+func handleReadyz(c *fiber.Ctx) error {
+	if !appReady.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(readiness{Status: "starting"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), 2*time.Second)
+	defer cancel()
+
+	checks := map[string]healthCheck{
+		"database":   checkDatabase(ctx),
+		"migrations": checkMigrations(ctx),
+		"sessions":   checkSessionStorage(),
+	}
+	result := readiness{Status: "ready", Checks: checks}
+	for _, check := range checks {
+		if check.Status != "ok" {
+			result.Status = "not_ready"
+			return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+		}
+	}
+	return c.JSON(result)
+}
+
+func checkDatabase(ctx context.Context) healthCheck {
+	sqlDB, err := db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	return checkResult(err)
+}
+
+func checkMigrations(ctx context.Context) healthCheck {
+	return checkResult(authService.CheckSchema(ctx))
+}
+
+// checkSessionStorage round-trips a probe key through the session storage.
+func checkSessionStorage() healthCheck {
+	key := "readyz-" + utils.UUIDv4()
+	if err := store.Storage.Set(key, []byte("ok"), time.Minute); err != nil {
+		return checkResult(err)
+	}
+	defer store.Storage.Delete(key)
+
+	value, err := store.Storage.Get(key)
+	if err == nil && string(value) != "ok" {
+		return healthCheck{Status: "failed", Error: "probe value did not round-trip"}
+	}
+	return checkResult(err)
+}
+
+func checkResult(err error) healthCheck {
+	if err != nil {
+		return healthCheck{Status: "failed", Error: err.Error()}
+	}
+	return healthCheck{Status: "ok"}
+}
@@ -0,0 +1,59 @@
+// Package env reads typed configuration from environment variables.
+package env
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// String returns the value of key, or def when it is unset or empty.
+func String(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// Duration parses key as a time.Duration, falling back to def.
+func Duration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("Invalid environment variable, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return d
+}
+
+// Int parses key as an integer, falling back to def.
+func Int(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("Invalid environment variable, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return n
+}
+
+// Bool parses key as a boolean, falling back to def.
+func Bool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("Invalid environment variable, using default", "key", key, "value", v, "default", def)
+		return def
+	}
+	return b
+}
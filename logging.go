@@ -0,0 +1,145 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/auth"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel/trace"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// logger is the application logger. It is built from LOG_FORMAT (text or
+// json) and LOG_LEVEL (debug, info, warn or error) and also becomes the
+// default for log/slog and the standard log package.
+var logger = newLogger()
+
+// redactedLogKeys are attribute keys whose values are never written, at
+// any nesting level.
+var redactedLogKeys = map[string]bool{
+	"password":         true,
+	"confirm_password": true,
+	"current_password": true,
+	"new_password":     true,
+	"token":            true,
+	"invite_code":      true,
+	"code":             true,
+	"cookie":           true,
+	"set-cookie":       true,
+	"authorization":    true,
+	"session_id":       true,
+	"session":          true,
+}
+
+func newLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	var handler slog.Handler
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	default:
+		slog.Error("Unknown LOG_FORMAT, want text or json", "value", format)
+		os.Exit(1)
+	}
+
+	l := slog.New(handler)
+	slog.SetDefault(l)
+	return l
+}
+
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	if redactedLogKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+	return a
+}
+
+// fatal logs msg at error level and exits.
+func fatal(msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// gormLogger routes GORM's slow query and error logs through logger.
+// Queries are logged without their parameters so stored secrets such as
+// password hashes never reach the logs.
+func gormLogger() gormlogger.Interface {
+	return gormlogger.NewSlogLogger(logger, gormlogger.Config{
+		LogLevel:                  gormlogger.Warn,
+		SlowThreshold:             200 * time.Millisecond,
+		ParameterizedQueries:      true,
+		IgnoreRecordNotFoundError: true,
+	})
+}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestIDMiddleware keeps a well-formed incoming X-Request-ID or
+// generates one, and echoes it in the response.
+func requestIDMiddleware(c *fiber.Ctx) error {
+	id := c.Get(fiber.HeaderXRequestID)
+	if !validRequestID.MatchString(id) {
+		id = utils.UUIDv4()
+	} else {
+		id = utils.CopyString(id)
+	}
+	c.Locals("requestID", id)
+	c.Set(fiber.HeaderXRequestID, id)
+	return c.Next()
+}
+
+// requestLogger returns logger annotated with the request ID, the trace ID
+// when tracing is enabled and the signed-in user's ID, if any.
+func requestLogger(c *fiber.Ctx) *slog.Logger {
+	l := logger
+	if id, ok := c.Locals("requestID").(string); ok {
+		l = l.With("request_id", id)
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		l = l.With("user_id", user.ID)
+	}
+	if sc := trace.SpanContextFromContext(c.UserContext()); sc.IsValid() {
+		l = l.With("trace_id", sc.TraceID().String())
+	}
+	return l
+}
+
+// accessLogMiddleware logs one line per request. Only the path is logged:
+// query strings can carry sign-in tokens, and bodies and cookies are never
+// read here.
+func accessLogMiddleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	if err != nil {
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	status := c.Response().StatusCode()
+	level := slog.LevelInfo
+	if status >= fiber.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	requestLogger(c).Log(c.UserContext(), level, "request",
+		"method", c.Method(),
+		"path", c.Path(),
+		"status", status,
+		"duration_ms", time.Since(start).Milliseconds(),
+		"ip", c.IP(),
+	)
+	return nil
+}
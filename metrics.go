@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "http_request_duration_seconds",
+	Help:    "HTTP request latency by route.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "route", "status"})
+
+func init() {
+	// Sessions seen within the idle timeout count as active.
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "auth_active_sessions",
+		Help: "Tracked sessions used within the session idle timeout.",
+	}, func() float64 {
+		if !appReady.Load() {
+			return 0
+		}
+		count, _ := authService.ActiveSessions(context.Background())
+		return float64(count)
+	})
+}
+
+// metricsMiddleware records the latency of every request, labelled with
+// the route pattern rather than the raw path to keep cardinality bounded.
+func metricsMiddleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	// Requests no route matched are left on this middleware's "/" route.
+	route := c.Route().Path
+	if route == "/" && c.Path() != "/" {
+		route = "unmatched"
+	}
+
+	requestDuration.WithLabelValues(utils.CopyString(c.Method()), route, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// mountMetrics exposes /metrics, either on app or, when METRICS_ADDR is
+// set, on a separate listener so it can stay off the public interface.
+// Setting METRICS_TOKEN requires it as a bearer token in both cases. It
+// returns the separate server so it can be shut down, or nil.
+func mountMetrics(app *fiber.App) *http.Server {
+	handler := promhttp.Handler()
+	token := env.String("METRICS_TOKEN", "")
+
+	if addr := env.String("METRICS_ADDR", ""); addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !validMetricsToken(token, r.Header.Get("Authorization")) {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    16 << 10,
+		}
+		go func() {
+			logger.Info("Metrics server listening", "url", "http://"+addr+"/metrics")
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("Metrics server failed", "error", err)
+			}
+		}()
+		return srv
+	}
+
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		if !validMetricsToken(token, c.Get(fiber.HeaderAuthorization)) {
+			return fiber.ErrUnauthorized
+		}
+		return c.Next()
+	}, adaptor.HTTPHandler(handler))
+	return nil
+}
+
+func validMetricsToken(token, authorization string) bool {
+	if token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+token)) == 1
+}
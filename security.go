@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/auth"
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cspReportPath receives Content-Security-Policy violation reports.
+const cspReportPath = "/csp-report"
+
+// defaultCSP allows only the app's own resources and the inline scripts
+// and styles carrying the request's nonce. {nonce} is replaced per request.
+const defaultCSP = "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; " +
+	"img-src 'self' data: https:; connect-src 'self'; font-src 'self'; form-action 'self'; " +
+	"base-uri 'none'; object-src 'none'; report-uri " + cspReportPath + "; report-to csp-endpoint"
+
+// securityHeaders is the policy sent with every response, read once from
+// the environment.
+var securityHeaders = struct {
+	csp                   string
+	cspReportOnly         bool
+	frameAncestors        string
+	referrerPolicy        string
+	permissionsPolicy     string
+	hstsMaxAge            int
+	hstsIncludeSubdomains bool
+}{
+	csp:                   env.String("CSP_POLICY", defaultCSP),
+	cspReportOnly:         env.Bool("CSP_REPORT_ONLY", false),
+	frameAncestors:        env.String("FRAME_ANCESTORS", "'none'"),
+	referrerPolicy:        env.String("REFERRER_POLICY", "same-origin"),
+	permissionsPolicy:     env.String("PERMISSIONS_POLICY", "camera=(), microphone=(), geolocation=(), payment=(), usb=()"),
+	hstsMaxAge:            env.Int("HSTS_MAX_AGE", 31536000),
+	hstsIncludeSubdomains: env.Bool("HSTS_INCLUDE_SUBDOMAINS", false),
+}
+
+// securityHeadersMiddleware sets the Content-Security-Policy, framing,
+// referrer, permissions and transport security headers. The CSP nonce is
+// created before the handler runs so the pages can embed it.
+func securityHeadersMiddleware(c *fiber.Ctx) error {
+	nonce := auth.CSPNonce(c)
+	err := c.Next()
+
+	h := securityHeaders
+	frameAncestors, frameOptions := h.frameAncestors, "SAMEORIGIN"
+	if auth.FramingDenied(c) || frameAncestors == "'none'" {
+		frameAncestors, frameOptions = "'none'", "DENY"
+	}
+	csp := strings.ReplaceAll(h.csp, "{nonce}", nonce) + "; frame-ancestors " + frameAncestors
+
+	if h.cspReportOnly {
+		c.Set(fiber.HeaderContentSecurityPolicyReportOnly, csp)
+	} else {
+		c.Set(fiber.HeaderContentSecurityPolicy, csp)
+	}
+	c.Set("Reporting-Endpoints", `csp-endpoint="`+cspReportPath+`"`)
+	c.Set(fiber.HeaderXFrameOptions, frameOptions)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderReferrerPolicy, h.referrerPolicy)
+	c.Set(fiber.HeaderPermissionsPolicy, h.permissionsPolicy)
+	c.Set("Cross-Origin-Opener-Policy", "same-origin")
+	if h.hstsMaxAge > 0 && c.Secure() {
+		hsts := "max-age=" + strconv.Itoa(h.hstsMaxAge)
+		if h.hstsIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+	}
+	return err
+}
+
+// cspViolation is the part of a violation report that gets logged. The
+// legacy report-uri format uses kebab-case keys, the Reporting API
+// camelCase ones.
+type cspViolation struct {
+	DocumentURI        string `json:"document-uri"`
+	Directive          string `json:"violated-directive"`
+	BlockedURI         string `json:"blocked-uri"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	DocumentURL        string `json:"documentURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	BlockedURL         string `json:"blockedURL"`
+	SourceFileAPI      string `json:"sourceFile"`
+	LineNumberAPI      int    `json:"lineNumber"`
+}
+
+// handleCSPReport logs the violations browsers report, sent either as
+// application/csp-report or as a Reporting API application/reports+json
+// batch.
+func handleCSPReport(c *fiber.Ctx) error {
+	var violations []cspViolation
+	var legacy struct {
+		Report *cspViolation `json:"csp-report"`
+	}
+	var batch []struct {
+		Type string       `json:"type"`
+		Body cspViolation `json:"body"`
+	}
+	switch body := c.Body(); {
+	case json.Unmarshal(body, &legacy) == nil && legacy.Report != nil:
+		violations = append(violations, *legacy.Report)
+	case json.Unmarshal(body, &batch) == nil:
+		for _, r := range batch {
+			if r.Type == "csp-violation" {
+				violations = append(violations, r.Body)
+			}
+		}
+	default:
+		return fiber.ErrBadRequest
+	}
+
+	log := requestLogger(c)
+	for _, v := range violations {
+		log.Warn("Content-Security-Policy violation",
+			"document_uri", firstNonEmpty(v.DocumentURI, v.DocumentURL),
+			"directive", firstNonEmpty(v.Directive, v.EffectiveDirective),
+			"blocked_uri", firstNonEmpty(v.BlockedURI, v.BlockedURL),
+			"source_file", firstNonEmpty(v.SourceFile, v.SourceFileAPI),
+			"line", max(v.LineNumber, v.LineNumberAPI))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
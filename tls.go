@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+)
+
+// certReloader serves a certificate and key from files, picking up new
+// versions when either file changes so certificates can be renewed
+// without a restart.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// modified returns the later of the two files' modification times.
+func (r *certReloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload loads the certificate if the files changed since the last load,
+// and reports whether it did. On error the current certificate is kept,
+// so a renewal caught halfway through is retried on the next check.
+func (r *certReloader) reload() (bool, error) {
+	modTime, err := r.modified()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.cert, r.modTime = &cert, modTime
+	r.mu.Unlock()
+	logger.Info("Loaded TLS certificate", "subject", cert.Leaf.Subject.String(), "expires", cert.Leaf.NotAfter)
+	return true, nil
+}
+
+// watch checks the files for changes every interval.
+func (r *certReloader) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := r.reload(); err != nil {
+			logger.Warn("Failed to reload TLS certificate, keeping the current one", "error", err)
+		}
+	}
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// tlsEnabled reports whether TLS_CERT_FILE and TLS_KEY_FILE are set.
+func tlsEnabled() bool {
+	return os.Getenv("TLS_CERT_FILE") != "" || os.Getenv("TLS_KEY_FILE") != ""
+}
+
+// listen opens the app's listener on addr: a TLS one serving
+// TLS_CERT_FILE and TLS_KEY_FILE when they are set, plain TCP otherwise.
+func listen(addr string) (net.Listener, error) {
+	if !tlsEnabled() {
+		return net.Listen("tcp", addr)
+	}
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	go certs.watch(env.Duration("TLS_RELOAD_INTERVAL", 10*time.Second))
+
+	return tls.Listen("tcp", addr, &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.getCertificate,
+		NextProtos:     []string{"http/1.1"},
+	})
+}
+
+// serveHTTPSRedirect answers plain HTTP on HTTP_REDIRECT_ADDR, when set,
+// with a permanent redirect to the same URL over HTTPS on httpsPort. It
+// returns the server so it can be shut down with the app, or nil when
+// HTTP_REDIRECT_ADDR is unset.
+func serveHTTPSRedirect(httpsPort string) *http.Server {
+	addr := env.String("HTTP_REDIRECT_ADDR", "")
+	if addr == "" {
+		return nil
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+	// Redirects are tiny, so tight timeouts only cut off slow or idle
+	// clients holding connections open.
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		MaxHeaderBytes:    16 << 10,
+	}
+	go func() {
+		logger.Info("Redirecting HTTP to HTTPS", "addr", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("HTTP redirect server failed", "error", err)
+		}
+	}()
+	return srv
+}
+
+// trustedProxies returns the addresses and CIDR ranges in TRUSTED_PROXIES,
+// the reverse proxies whose X-Forwarded-* headers are believed.
+func trustedProxies() []string {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// secureCookies reports whether cookies need the Secure flag. COOKIE_SECURE
+// forces it either way; by default it is set when the app serves TLS itself
+// or sits behind trusted proxies, which are expected to terminate HTTPS.
+func secureCookies() bool {
+	switch v := env.String("COOKIE_SECURE", "auto"); v {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "auto":
+		return tlsEnabled() || len(trustedProxies()) > 0
+	default:
+		fatal("Unknown COOKIE_SECURE, want auto, true or false", "value", v)
+		return false
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/smart-developer1791/go-fiber-auth-3d/auth"
+	"github.com/smart-developer1791/go-fiber-auth-3d/internal/env"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// tracer creates every span in the app. Until initTracing installs a
+// provider it hands out no-op spans.
+var tracer = otel.Tracer("github.com/smart-developer1791/go-fiber-auth-3d")
+
+// initTracing installs the exporter selected by OTEL_TRACES_EXPORTER:
+// none (default), stdout, file (OTEL_TRACES_FILE) or otlp (configured by
+// the standard OTEL_EXPORTER_OTLP_* variables). The returned function
+// flushes pending spans.
+func initTracing() func(context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch name := env.String("OTEL_TRACES_EXPORTER", "none"); name {
+	case "none":
+		return func(context.Context) error { return nil }
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "file":
+		path := env.String("OTEL_TRACES_FILE", "traces.jsonl")
+		f, openErr := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if openErr != nil {
+			fatal("Failed to open OTEL_TRACES_FILE", "path", path, "error", openErr)
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background())
+	default:
+		fatal("Unknown OTEL_TRACES_EXPORTER, want none, stdout, file or otlp", "value", name)
+	}
+	if err != nil {
+		fatal("Failed to create trace exporter", "error", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", env.String("OTEL_SERVICE_NAME", "fiber-auth-3d")),
+	))
+	if err != nil {
+		res = resource.Default()
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	logger.Info("Tracing enabled", "exporter", env.String("OTEL_TRACES_EXPORTER", "none"))
+	return provider.Shutdown
+}
+
+// fiberHeaderCarrier adapts Fiber request headers for propagators.
+type fiberHeaderCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h fiberHeaderCarrier) Get(key string) string { return h.c.Get(key) }
+
+func (h fiberHeaderCarrier) Set(key, value string) { h.c.Request().Header.Set(key, value) }
+
+func (h fiberHeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(h.c.GetReqHeaders()))
+	for k := range h.c.GetReqHeaders() {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// tracingMiddleware starts a server span per request, continuing any W3C
+// trace context sent by the caller, and stores it in the user context so
+// database and password spans nest under it.
+func tracingMiddleware(c *fiber.Ctx) error {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), fiberHeaderCarrier{c})
+	method := utils.CopyString(c.Method())
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.path", utils.CopyString(c.Path())),
+		attribute.String("client.address", c.IP()),
+	))
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	status := c.Response().StatusCode()
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+
+	route := c.Route().Path
+	if route == "/" && c.Path() != "/" {
+		route = "unmatched"
+	}
+	span.SetName(method + " " + route)
+	span.SetAttributes(attribute.String("http.route", route), attribute.Int("http.response.status_code", status))
+	if id, ok := c.Locals("requestID").(string); ok {
+		span.SetAttributes(attribute.String("request.id", id))
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		span.SetAttributes(attribute.String("enduser.id", strconv.FormatUint(uint64(user.ID), 10)))
+	}
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, strconv.Itoa(status))
+	}
+	return err
+}
+
+// registerGormTracing adds a span around every query run with a context
+// that already carries a span. Queries outside requests, such as startup
+// backfills, are not traced.
+func registerGormTracing(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("otel:before_create", startGormSpan("create")),
+		cb.Create().After("gorm:create").Register("otel:after_create", endGormSpan),
+		cb.Query().Before("gorm:query").Register("otel:before_query", startGormSpan("query")),
+		cb.Query().After("gorm:query").Register("otel:after_query", endGormSpan),
+		cb.Update().Before("gorm:update").Register("otel:before_update", startGormSpan("update")),
+		cb.Update().After("gorm:update").Register("otel:after_update", endGormSpan),
+		cb.Delete().Before("gorm:delete").Register("otel:before_delete", startGormSpan("delete")),
+		cb.Delete().After("gorm:delete").Register("otel:after_delete", endGormSpan),
+		cb.Row().Before("gorm:row").Register("otel:before_row", startGormSpan("row")),
+		cb.Row().After("gorm:row").Register("otel:after_row", endGormSpan),
+		cb.Raw().Before("gorm:raw").Register("otel:before_raw", startGormSpan("raw")),
+		cb.Raw().After("gorm:raw").Register("otel:after_raw", endGormSpan),
+	)
+}
+
+func startGormSpan(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			return
+		}
+		ctx, span := tracer.Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		tx.Statement.Context = ctx
+		tx.InstanceSet("otel:span", span)
+	}
+}
+
+func endGormSpan(tx *gorm.DB) {
+	v, ok := tx.InstanceGet("otel:span")
+	if !ok {
+		return
+	}
+	span := v.(trace.Span)
+	defer span.End()
+
+	// The SQL is parameterized, so no values reach the trace.
+	span.SetAttributes(
+		attribute.String("db.system.name", tx.Dialector.Name()),
+		attribute.String("db.collection.name", tx.Statement.Table),
+		attribute.String("db.query.text", tx.Statement.SQL.String()),
+		attribute.Int64("db.response.returned_rows", tx.Statement.RowsAffected),
+	)
+	if err := tx.Statement.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}